@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"./input"
+)
+
+// DefaultAccount holds the rows of files that belong to no account: files
+// right under the history path read without a profile naming an account.
+const DefaultAccount = "default"
+
+// AccountColumn is the history column naming the account of a row.
+const AccountColumn = "account"
+
+// accountColumns are the columns of the accounts table and its csv file.
+// Opening is the balance of the account at the start of the opened day.
+var accountColumns = []string{"name", "type", "currency", "institution", "opening", "opened"}
+var accountTypes = []string{"TEXT", "TEXT", "TEXT", "TEXT", input.AmountType, "TIMESTAMP"}
+
+// Account is an entry of the accounts registry. Type is free text such as
+// checking, savings or credit.
+type Account struct {
+	Name        string
+	Type        string
+	Currency    string
+	Institution string
+	// Transactions counts the history rows of the account.
+	Transactions int
+}
+
+// accountInput wraps an input and appends the account to every row.
+type accountInput struct {
+	input.Input
+	account string
+}
+
+func (a *accountInput) Columns() []string {
+	return append(append([]string{}, a.Input.Columns()...), AccountColumn)
+}
+
+func (a *accountInput) Types() []string {
+	return append(append([]string{}, a.Input.Types()...), "TEXT")
+}
+
+func (a *accountInput) ReadRow() []string {
+	row := a.Input.ReadRow()
+	if row == nil {
+		return nil
+	}
+	columnLen := len(a.Input.Columns())
+	if len(row) > columnLen {
+		row = row[:columnLen]
+	}
+	return append(row, a.account)
+}
+
+// withAccount tags the rows of in, read from file p under the history path
+// root, with their account: the subdirectory of root holding the file,
+// else the account of the profile it is read with, else DefaultAccount.
+// Inputs with an account column of their own are left as they are.
+func withAccount(in input.Input, root string, p string) input.Input {
+	if columnIndex(in.Columns(), AccountColumn) >= 0 {
+		return in
+	}
+	account := DefaultAccount
+	rel, err := filepath.Rel(root, p)
+	if dir := filepath.Dir(rel); err == nil && dir != "." {
+		account = strings.Split(filepath.ToSlash(dir), "/")[0]
+	} else if profileInput, ok := in.(*input.ProfileInput); ok && profileInput.Profile.Account != "" {
+		account = profileInput.Profile.Account
+	}
+	return &accountInput{Input: in, account: account}
+}
+
+// Accounts lists the registered accounts followed by the ones only seen in
+// the history.
+func (ms *MoneySense) Accounts() ([]Account, error) {
+	var result []Account
+
+	query := fmt.Sprintf(`SELECT name, IFNULL(type, ''), IFNULL(currency, ''), IFNULL(institution, '') FROM "%v" ORDER BY rowid ASC`, ms.accounts)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for rows.Next() {
+		var a Account
+		err = rows.Scan(&a.Name, &a.Type, &a.Currency, &a.Institution)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[a.Name] = len(result)
+		result = append(result, a)
+	}
+	rows.Close()
+
+	query = fmt.Sprintf(`SELECT IFNULL(%[1]v, '%[2]v'), count(*) FROM "%[3]v" GROUP BY IFNULL(%[1]v, '%[2]v') ORDER BY 1`,
+		AccountColumn, DefaultAccount, ms.history)
+	rows, err = ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		err = rows.Scan(&name, &count)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(result)
+			result = append(result, Account{Name: name})
+		}
+		result[i].Transactions = count
+	}
+	return result, rows.Err()
+}
+
+// SetAccount registers a, or updates the account of the same name.
+func (ms *MoneySense) SetAccount(a Account) error {
+	query := fmt.Sprintf(`UPDATE "%v" SET type = ?, currency = ?, institution = ? WHERE name = ?`, ms.accounts)
+	result, err := ms.store.Exec(query, a.Type, a.Currency, a.Institution, a.Name)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		query = fmt.Sprintf(`INSERT INTO "%v"(name, type, currency, institution) VALUES(?, ?, ?, ?)`, ms.accounts)
+		_, err = ms.store.Exec(query, a.Name, a.Type, a.Currency, a.Institution)
+		if err != nil {
+			return err
+		}
+	}
+	if ms.accountsPath != "" {
+		ms.saveTable(ms.accounts, ms.accountsPath)
+	}
+	return nil
+}
+
+// accountCondition is the SQL condition keeping the rows of the accounts
+// filtered on, prefixed with the table alias if any.
+func (ms *MoneySense) accountCondition(alias string) string {
+	if len(ms.accountFilter) == 0 {
+		return "1"
+	}
+	var names []string
+	for _, a := range ms.accountFilter {
+		names = append(names, "'"+strings.Replace(a, "'", "''", -1)+"'")
+	}
+	return fmt.Sprintf("IFNULL(%v%v, '%v') IN (%v)", alias, AccountColumn, DefaultAccount, strings.Join(names, ", "))
+}
+
+// splitAccountFilter takes the "@account" arguments out of a command.
+func splitAccountFilter(args []string) ([]string, []string) {
+	var rest, accounts []string
+	for _, a := range args {
+		if strings.HasPrefix(a, "@") && len(a) > 1 {
+			accounts = append(accounts, a[1:])
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return rest, accounts
+}
+
+// parseAccount reads the "<name> <type> <currency> [institution]"
+// arguments of the account command.
+func parseAccount(args []string) (Account, error) {
+	if len(args) < 3 {
+		return Account{}, errors.New("Require name, type, currency and optionally institution.")
+	}
+	return Account{
+		Name:        args[0],
+		Type:        args[1],
+		Currency:    strings.ToUpper(args[2]),
+		Institution: strings.Join(args[3:], " "),
+	}, nil
+}
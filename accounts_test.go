@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAccountFilter(t *testing.T) {
+	cases := []struct {
+		args     []string
+		rest     []string
+		accounts []string
+	}{
+		{[]string{"pc", "01/01/2019", "02/01/2019"}, []string{"pc", "01/01/2019", "02/01/2019"}, nil},
+		{[]string{"pc", "@checking", "01/01/2019", "@savings"}, []string{"pc", "01/01/2019"}, []string{"checking", "savings"}},
+		// A lone @ is not an account.
+		{[]string{"tx", "@"}, []string{"tx", "@"}, nil},
+	}
+	for _, c := range cases {
+		rest, accounts := splitAccountFilter(c.args)
+		if !reflect.DeepEqual(rest, c.rest) || !reflect.DeepEqual(accounts, c.accounts) {
+			t.Errorf("splitAccountFilter(%v) = %v, %v, expected %v, %v", c.args, rest, accounts, c.rest, c.accounts)
+		}
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	a, err := parseAccount([]string{"checking", "checking", "usd", "First", "National"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Account{Name: "checking", Type: "checking", Currency: "USD", Institution: "First National"}
+	if a != expected {
+		t.Errorf("Expected %+v, got %+v", expected, a)
+	}
+	if _, err := parseAccount([]string{"checking", "checking"}); err == nil {
+		t.Errorf("Expected an account without currency to fail")
+	}
+}
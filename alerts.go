@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"./money"
+	"./output"
+)
+
+// Kinds of alerts: an amount far above the usual of its mechant or
+// category, a large first charge from a mechant, the same charge twice on
+// one day, and a charge on a weekday its mechant never charges on.
+const (
+	AlertOutlier   = "outlier"
+	AlertNew       = "new"
+	AlertDuplicate = "duplicate"
+	AlertWeekday   = "weekday"
+)
+
+// alertRatio is how many times the usual amount a charge has to be to be
+// out of character, alertDeviations how many scaled median absolute
+// deviations above it.
+const (
+	alertRatio      = 3
+	alertDeviations = 3.5
+	// alertSamples is how many earlier charges a baseline needs, and
+	// weekdaySamples how many it needs to know the weekdays of a mechant.
+	alertSamples   = 3
+	weekdaySamples = 8
+)
+
+// alertColumns are the columns of the exported alert report.
+var alertColumns = []string{"id", "account", "date", "mechant", "category", "amount", "kind", "reason"}
+var alertTypes = []string{"TEXT", "TEXT", "TIMESTAMP", "TEXT", "TEXT", "REAL", "TEXT", "TEXT"}
+
+// Alert is a transaction out of character and why.
+type Alert struct {
+	Transaction
+	Kind   string
+	Reason string
+}
+
+// baseline is what is usual for a mechant or a category, from the charges
+// before the one looked at.
+type baseline struct {
+	amounts  []money.Amount
+	weekdays [7]int
+}
+
+func (b *baseline) add(t Transaction) {
+	b.amounts = append(b.amounts, t.Amount)
+	b.weekdays[t.Date.Weekday()]++
+}
+
+// median returns the median amount and the median absolute deviation
+// from it.
+func (b *baseline) median() (money.Amount, money.Amount) {
+	median := medianAmount(b.amounts)
+	deviations := make([]money.Amount, len(b.amounts))
+	for i, a := range b.amounts {
+		deviations[i] = a - median
+		if deviations[i] < 0 {
+			deviations[i] = -deviations[i]
+		}
+	}
+	return median, medianAmount(deviations)
+}
+
+// outlier tells whether amount is far enough above the baseline, with
+// the median of the baseline and how many times the median amount is.
+func (b *baseline) outlier(amount money.Amount) (bool, money.Amount, float64) {
+	if len(b.amounts) < alertSamples {
+		return false, 0, 0
+	}
+	median, mad := b.median()
+	if median <= 0 {
+		return false, median, 0
+	}
+	ratio := float64(amount) / float64(median)
+	if ratio < alertRatio {
+		return false, median, ratio
+	}
+	// 1.4826 scales the median absolute deviation to a standard deviation.
+	if mad > 0 && float64(amount-median) < alertDeviations*1.4826*float64(mad) {
+		return false, median, ratio
+	}
+	return true, median, ratio
+}
+
+// usualWeekdays lists the weekdays of the baseline, or nothing when one
+// of them is day or there are too few charges to tell.
+func (b *baseline) usualWeekdays(day time.Weekday) []string {
+	if len(b.amounts) < weekdaySamples || b.weekdays[day] > 0 {
+		return nil
+	}
+	var days []string
+	for d, n := range b.weekdays {
+		if n > 0 {
+			days = append(days, time.Weekday(d).String()[:3])
+		}
+	}
+	return days
+}
+
+func medianAmount(amounts []money.Amount) money.Amount {
+	if len(amounts) == 0 {
+		return 0
+	}
+	sorted := append([]money.Amount(nil), amounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// Alerts flags the charges between start and end that are out of
+// character with the history before them. Refunds, income and transfers
+// between our accounts are left out, as are same day pairs kept with
+// keepdup.
+func (ms *MoneySense) Alerts(start time.Time, end time.Time) ([]Alert, error) {
+	var result []Alert
+
+	transactions, err := ms.Transactions(ms.firstDate(start).Format(TimeFormat), end.Format(TimeFormat), "")
+	if err != nil {
+		return nil, err
+	}
+	transfers := ms.transferIDs()
+	kept := ms.keptPairs()
+	d := ms.digits()
+
+	all := &baseline{}
+	mechants := make(map[string]*baseline)
+	categories := make(map[string]*baseline)
+	sameDay := make(map[string]string)
+	for _, t := range transactions {
+		if t.Amount <= 0 || transfers[t.ID] {
+			continue
+		}
+		key := recurringKey(t.Mechant)
+		if mechants[key] == nil {
+			mechants[key] = &baseline{}
+		}
+		if categories[t.Category] == nil {
+			categories[t.Category] = &baseline{}
+		}
+		m, c := mechants[key], categories[t.Category]
+		dayKey := strings.Join([]string{t.Account, t.Date.Format(TimeFormat), t.Mechant, t.Amount.Format(d)}, "|")
+		first, twice := sameDay[dayKey]
+
+		if !t.Date.Before(start) {
+			var alerts []Alert
+			if twice && !kept[first+"|"+t.ID] {
+				alerts = append(alerts, Alert{t, AlertDuplicate, "charged twice on the same day, see " + first})
+			}
+			// A mechant is compared with its own charges, and while it
+			// has too few of them with its category or, for a new one in
+			// a new category, with all charges.
+			if ok, median, ratio := m.outlier(t.Amount); ok {
+				alerts = append(alerts, Alert{t, AlertOutlier, fmt.Sprintf("%.1fx the usual $%v at %v", ratio, median.Format(d), key)})
+			} else if len(m.amounts) < alertSamples {
+				if ok, median, ratio := c.outlier(t.Amount); ok {
+					kind, reason := AlertOutlier, fmt.Sprintf("%.1fx the usual $%v in %v", ratio, median.Format(d), categoryName(t.Category))
+					if len(m.amounts) == 0 {
+						kind, reason = AlertNew, "first charge from "+key+", "+reason
+					}
+					alerts = append(alerts, Alert{t, kind, reason})
+				} else if len(m.amounts) == 0 && len(c.amounts) < alertSamples {
+					if ok, median, ratio := all.outlier(t.Amount); ok {
+						alerts = append(alerts, Alert{t, AlertNew, fmt.Sprintf("first charge from %v, %.1fx the usual $%v", key, ratio, median.Format(d))})
+					}
+				}
+			}
+			if days := m.usualWeekdays(t.Date.Weekday()); days != nil {
+				alerts = append(alerts, Alert{t, AlertWeekday, fmt.Sprintf("on a %v, %v usually charges on %v", t.Date.Weekday(), key, strings.Join(days, ", "))})
+			}
+			result = append(result, alerts...)
+		}
+
+		if !twice {
+			sameDay[dayKey] = t.ID
+		}
+		all.add(t)
+		m.add(t)
+		c.add(t)
+	}
+	return result, nil
+}
+
+// categoryName is how reports name category, which may be empty.
+func categoryName(category string) string {
+	if category == "" {
+		return "no category"
+	}
+	return category
+}
+
+// ExportAlerts writes alerts to fileName as a csv report.
+func (ms *MoneySense) ExportAlerts(alerts []Alert, fileName string) error {
+	writer, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{
+		Separator:  ',',
+		WriteTo:    writer,
+		TimeFormat: TimeFormat,
+	})
+	err = csvOutput.WriteHeader(alertTypes, alertColumns)
+	if err != nil {
+		return err
+	}
+	for _, a := range alerts {
+		err = csvOutput.WriteRow([]string{
+			a.ID,
+			a.Account,
+			a.Date.Format(TimeFormat),
+			a.Mechant,
+			a.Category,
+			a.Amount.Format(ms.digits()),
+			a.Kind,
+			a.Reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return csvOutput.Flush()
+}
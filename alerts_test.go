@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestBaselineOutlier(t *testing.T) {
+	cases := []struct {
+		name     string
+		amounts  []money.Amount
+		amount   money.Amount
+		expected bool
+	}{
+		{"too few charges", []money.Amount{1000, 1000}, 10000, false},
+		{"below the ratio", []money.Amount{1000, 1000, 1000}, 2999, false},
+		{"at the ratio", []money.Amount{1000, 1000, 1000}, 3000, true},
+		{"steady", []money.Amount{1000, 1200, 800}, 3000, true},
+		// The median absolute deviation is 9.00, 3.5 scaled deviations
+		// are 46.69 above the median of 10.00.
+		{"within the deviations", []money.Amount{1000, 2000, 100, 1000, 1900}, 5000, false},
+		{"beyond the deviations", []money.Amount{1000, 2000, 100, 1000, 1900}, 6000, true},
+		{"nothing charged", []money.Amount{0, 0, 0}, 1000, false},
+	}
+	for _, c := range cases {
+		b := &baseline{amounts: c.amounts}
+		if ok, _, _ := b.outlier(c.amount); ok != c.expected {
+			t.Errorf("%v: outlier(%v) = %v, expected %v", c.name, c.amount, ok, c.expected)
+		}
+	}
+}
+
+func TestBaselineUsualWeekdays(t *testing.T) {
+	// 2019-01-07 is a Monday.
+	monday := time.Date(2019, 1, 7, 0, 0, 0, 0, time.UTC)
+	b := &baseline{}
+	for i := 0; i < weekdaySamples-1; i++ {
+		b.add(Transaction{Date: monday.AddDate(0, 0, 7*i+2*(i%2)), Amount: 1000})
+	}
+	if days := b.usualWeekdays(time.Friday); days != nil {
+		t.Errorf("Expected too few charges to tell, got %v", days)
+	}
+	b.add(Transaction{Date: monday.AddDate(0, 0, 70), Amount: 1000})
+	if days := b.usualWeekdays(time.Wednesday); days != nil {
+		t.Errorf("Expected Wednesday to be usual, got %v", days)
+	}
+	if days := b.usualWeekdays(time.Friday); !reflect.DeepEqual(days, []string{"Mon", "Wed"}) {
+		t.Errorf("Expected Mon and Wed, got %v", days)
+	}
+}
+
+func TestMedianAmount(t *testing.T) {
+	cases := []struct {
+		amounts  []money.Amount
+		expected money.Amount
+	}{
+		{nil, 0},
+		{[]money.Amount{5}, 5},
+		{[]money.Amount{3, 1, 2}, 2},
+		{[]money.Amount{4, 1, 3, 2}, 3},
+	}
+	for _, c := range cases {
+		if m := medianAmount(c.amounts); m != c.expected {
+			t.Errorf("medianAmount(%v) = %v, expected %v", c.amounts, m, c.expected)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"./money"
+	"./storage"
+)
+
+// reconcileDays is how many days after a statement date transactions are
+// looked at as posted too late for the statement.
+const reconcileDays = 7
+
+// Balance is the balance of an account at the end of a day, in the
+// currency of the account.
+type Balance struct {
+	Date   time.Time
+	Amount money.Amount
+}
+
+// Reconciliation is a statement ending balance compared with the balance
+// reconstructed from the history.
+type Reconciliation struct {
+	Account   string
+	Date      time.Time
+	Statement money.Amount
+	Computed  money.Amount
+	// Candidates are the transactions that would explain the difference.
+	Candidates []ReconcileCandidate
+}
+
+func (r Reconciliation) Discrepancy() money.Amount {
+	return r.Statement - r.Computed
+}
+
+// ReconcileCandidate is a transaction that accounts for the discrepancy of
+// a reconciliation, and why.
+type ReconcileCandidate struct {
+	Transaction
+	Reason string
+}
+
+// SetOpening sets the balance of account at the start of date, registering
+// the account if needed. Transactions before date are taken to be part of
+// it.
+func (ms *MoneySense) SetOpening(account string, amount money.Amount, date time.Time) error {
+	currency, ok := ms.accountCurrencies()[account]
+	if !ok {
+		err := ms.SetAccount(Account{Name: account})
+		if err != nil {
+			return err
+		}
+	}
+	query := fmt.Sprintf(`UPDATE "%v" SET opening = ?, opened = ?, %v = ? WHERE name = ?`, ms.accounts, storage.DigitsColumn)
+	_, err := ms.store.Exec(query, amount, date, ms.currencyDigits(currency), account)
+	if err != nil {
+		return err
+	}
+	if ms.accountsPath != "" {
+		ms.saveTable(ms.accounts, ms.accountsPath)
+	}
+	return nil
+}
+
+// opening returns the opening balance of account, in minor units of
+// digits digits, and the day it applies from, zero since the beginning of
+// time when it has none.
+func (ms *MoneySense) opening(account string, digits int) (money.Amount, time.Time) {
+	var amount money.Amount
+	var date *time.Time
+	query := fmt.Sprintf(`SELECT %v, opened FROM "%v" WHERE name = ?`, toMaxDigits("IFNULL(opening, 0)", ""), ms.accounts)
+	err := ms.store.QueryRow(query, account).Scan(&amount, &date)
+	opening := amount.Rescale(money.MaxDigits, digits)
+	if err != nil || date == nil {
+		return opening, time.Time{}
+	}
+	return opening, *date
+}
+
+// accountDigits are the digits of the minor unit of the currency of
+// account, the base currency when it has none.
+func (ms *MoneySense) accountDigits(account string) int {
+	return ms.currencyDigits(ms.accountCurrencies()[account])
+}
+
+// rowDigits are the digits of the minor unit of the currency of a row:
+// currency, else the one of account, else the base currency.
+func (ms *MoneySense) rowDigits(account string, currency string, currencies map[string]string) int {
+	if currency == "" {
+		currency = currencies[account]
+	}
+	return ms.currencyDigits(currency)
+}
+
+// currencyDigits are the digits of the minor unit of currency, the base
+// currency when it is empty.
+func (ms *MoneySense) currencyDigits(currency string) int {
+	if currency != "" {
+		return money.Digits(currency)
+	}
+	return ms.digits()
+}
+
+// accountTransactions lists the transactions of account from its opening
+// day opened on.
+func (ms *MoneySense) accountTransactions(account string, opened time.Time) ([]Transaction, error) {
+	var result []Transaction
+
+	all, err := ms.allTransactions()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range all {
+		if t.Account == account && !t.Date.Before(opened) {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// Balances returns the end of day balance of account for every day from
+// start to end, in the currency of the account.
+func (ms *MoneySense) Balances(account string, start time.Time, end time.Time) ([]Balance, error) {
+	var result []Balance
+
+	digits := ms.accountDigits(account)
+	balance, opened := ms.opening(account, digits)
+	transactions, err := ms.accountTransactions(account, opened)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		for ; i < len(transactions) && transactions[i].Date.Before(day.AddDate(0, 0, 1)); i++ {
+			t := transactions[i]
+			balance -= t.Original.Rescale(money.Digits(t.Currency), digits)
+		}
+		result = append(result, Balance{Date: day, Amount: balance})
+	}
+	return result, nil
+}
+
+// Reconcile compares the statement ending balance of account on date with
+// the balance of the history, and when they differ looks for transactions
+// that would explain it: ones in the history twice, ones posted after the
+// statement date, and ones imported into another account.
+func (ms *MoneySense) Reconcile(account string, date time.Time, statement money.Amount) (Reconciliation, error) {
+	r := Reconciliation{Account: account, Date: date, Statement: statement}
+
+	balances, err := ms.Balances(account, date, date)
+	if err != nil {
+		return r, err
+	}
+	r.Computed = balances[0].Amount
+	digits := ms.accountDigits(account)
+	query := fmt.Sprintf(`INSERT INTO ms_reconciliations(account, date, statement, computed, %v) VALUES(?, ?, ?, ?, ?)`, storage.DigitsColumn)
+	_, err = ms.store.Exec(query, account, date, statement, r.Computed, digits)
+	if err != nil {
+		return r, err
+	}
+	discrepancy := r.Discrepancy()
+	if discrepancy == 0 {
+		return r, nil
+	}
+
+	all, err := ms.allTransactions()
+	if err != nil {
+		return r, err
+	}
+	duplicates := make(map[string]bool)
+	for _, d := range ms.NearDuplicates(reconcileDays) {
+		duplicates[d.ID] = true
+		duplicates[d.OtherID] = true
+	}
+	_, opened := ms.opening(account, digits)
+	dayAfter := date.AddDate(0, 0, 1)
+	late := dayAfter.AddDate(0, 0, reconcileDays)
+	for _, t := range all {
+		// A transaction moves the balance by minus its amount.
+		amount := t.Original.Rescale(money.Digits(t.Currency), digits)
+		matches := -amount == discrepancy
+		undoes := amount == discrepancy
+		switch {
+		case t.Account == account && undoes && !t.Date.Before(opened) && t.Date.Before(dayAfter):
+			reason := "counted but not on the statement"
+			if duplicates[t.ID] {
+				reason = "likely duplicate"
+			}
+			r.Candidates = append(r.Candidates, ReconcileCandidate{t, reason})
+		case t.Account == account && matches && !t.Date.Before(dayAfter) && t.Date.Before(late):
+			r.Candidates = append(r.Candidates, ReconcileCandidate{t, "posted after the statement date"})
+		case t.Account != account && matches && t.Date.Before(dayAfter) && !t.Date.Before(date.AddDate(0, 0, -31)):
+			r.Candidates = append(r.Candidates, ReconcileCandidate{t, "imported into " + t.Account})
+		}
+	}
+	return r, nil
+}
+
+// Reconciliations lists the past reconciliations of account.
+func (ms *MoneySense) Reconciliations(account string) ([]Reconciliation, error) {
+	var result []Reconciliation
+
+	query := fmt.Sprintf(`SELECT account, date, %v, %v FROM ms_reconciliations WHERE account = ? ORDER BY date ASC`, toMaxDigits("statement", ""), toMaxDigits("computed", ""))
+	rows, err := ms.store.Query(query, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	digits := ms.accountDigits(account)
+	for rows.Next() {
+		var r Reconciliation
+		err = rows.Scan(&r.Account, &r.Date, &r.Statement, &r.Computed)
+		if err != nil {
+			return nil, err
+		}
+		r.Statement = r.Statement.Rescale(money.MaxDigits, digits)
+		r.Computed = r.Computed.Rescale(money.MaxDigits, digits)
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// parseReconcile reads the "<account> <date> <balance>" arguments of the
+// reconcile command, the balance in the currency of the account.
+func parseReconcile(args []string, accountDigits func(string) int) (string, time.Time, money.Amount, error) {
+	if len(args) != 3 {
+		return "", time.Time{}, 0, errors.New("Require account, statement date and ending balance.")
+	}
+	date, err := time.Parse(TimeFormat, args[1])
+	if err != nil {
+		return "", time.Time{}, 0, fmt.Errorf("Failed to parse date: %v", args[1])
+	}
+	balance, err := money.Parse(args[2], '.', accountDigits(args[0]))
+	if err != nil {
+		return "", time.Time{}, 0, fmt.Errorf("Bad balance %q", args[2])
+	}
+	return args[0], date, balance, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestParseReconcile(t *testing.T) {
+	digits := func(account string) int {
+		if account == "yen" {
+			return 0
+		}
+		return 2
+	}
+	cases := []struct {
+		args    []string
+		account string
+		balance money.Amount
+		ok      bool
+	}{
+		{[]string{"checking", "01/31/2019", "1,234.56"}, "checking", 123456, true},
+		{[]string{"checking", "01/31/2019", "-12"}, "checking", -1200, true},
+		{[]string{"yen", "01/31/2019", "1500"}, "yen", 1500, true},
+		// Balances finer than the currency of the account are refused.
+		{[]string{"yen", "01/31/2019", "15.5"}, "", 0, false},
+		{[]string{"checking", "2019-01-31", "12"}, "", 0, false},
+		{[]string{"checking", "01/31/2019"}, "", 0, false},
+	}
+	for _, c := range cases {
+		account, date, balance, err := parseReconcile(c.args, digits)
+		if (err == nil) != c.ok {
+			t.Errorf("parseReconcile(%v) = %v, expected ok %v", c.args, err, c.ok)
+			continue
+		}
+		if !c.ok {
+			continue
+		}
+		if account != c.account || balance != c.balance || !date.Equal(time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("parseReconcile(%v) = %v %v %v", c.args, account, date, balance)
+		}
+	}
+}
+
+func TestReconciliationDiscrepancy(t *testing.T) {
+	r := Reconciliation{Statement: 100000, Computed: 120000}
+	if r.Discrepancy() != -20000 {
+		t.Errorf("Expected a discrepancy of -20000, got %v", r.Discrepancy())
+	}
+}
+
+func TestBalancesWithoutExchangeRate(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		"history/checking/jan.csv": "TIMESTAMP,TEXT,REAL,REAL\ndate,mechant,credit,debit\n01/03/2019,SAFEWAY,20.5,\n01/05/2019,XFER,100,\n",
+		"history/euro/jan.csv":     "TIMESTAMP,TEXT,REAL,REAL\ndate,mechant,credit,debit\n01/04/2019,MONOPRIX,12.25,\n01/06/2019,XFER,,90\n",
+		"accounts.csv":             "TEXT,TEXT,TEXT,TEXT,REAL,TIMESTAMP\nname,type,currency,institution,opening,opened\nchecking,,USD,,1000,01/01/2019\neuro,,EUR,,50,01/01/2019\n",
+	}, MoneySenseOptions{Base: "USD"})
+
+	day := func(d int) time.Time {
+		return time.Date(2019, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	// There is no rate from EUR to USD, the balances of the account in
+	// euros need none.
+	balances, err := ms.Balances("euro", day(6), day(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Amount != 12775 {
+		t.Errorf("Expected a balance of 127.75, got %v", balances)
+	}
+	r, err := ms.Reconcile("euro", day(6), 12775)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Discrepancy() != 0 {
+		t.Errorf("Expected no discrepancy, got %v", r.Discrepancy())
+	}
+
+	// Without a rate the transfer can not be matched across currencies,
+	// nor can it be without a base currency.
+	matched, ambiguous, err := ms.MatchTransfers(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched != 0 || len(ambiguous) != 0 {
+		t.Errorf("Expected no transfers, got %v and %v", matched, ambiguous)
+	}
+}
+
+func TestAmountsInMinorUnits(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		"history/yen/jan.csv":   "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n01/03/2019,SUSHI,1500\n",
+		"history/dinar/jan.csv": "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n01/03/2019,SOUK,1.234\n",
+		"accounts.csv":          "TEXT,TEXT,TEXT,TEXT,REAL,TIMESTAMP\nname,type,currency,institution,opening,opened\nyen,,JPY,,10000,01/01/2019\ndinar,,BHD,,5,01/01/2019\n",
+	}, MoneySenseOptions{})
+
+	tests := []struct {
+		mechant string
+		credit  int64
+		digits  int
+	}{
+		{"SUSHI", 1500, 0},
+		{"SOUK", 1234, 3},
+	}
+	for _, test := range tests {
+		var credit int64
+		var digits int
+		query := fmt.Sprintf(`SELECT credit, digits FROM "%v" WHERE mechant = ?`, ms.history)
+		err := ms.store.QueryRow(query, test.mechant).Scan(&credit, &digits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credit != test.credit || digits != test.digits {
+			t.Errorf("Expected %v stored as %v to %v digits, got %v to %v", test.mechant, test.credit, test.digits, credit, digits)
+		}
+	}
+
+	day := time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC)
+	for account, expected := range map[string]money.Amount{"yen": 8500, "dinar": 3766} {
+		balances, err := ms.Balances(account, day, day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(balances) != 1 || balances[0].Amount != expected {
+			t.Errorf("Expected a balance of %v for %v, got %v", expected, account, balances)
+		}
+	}
+
+	err := ms.SetGoal(Goal{Name: "trip", Target: 50000, Deadline: day, Account: "yen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	goals, err := ms.Goals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 1 || goals[0].Target != 50000 {
+		t.Errorf("Expected a target of 50000 yen, got %v", goals)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"./input"
+	"./money"
+	"./output"
+)
+
+// The pending review file lists the mechants a batch run could not
+// classify. Filling in category, and optionally match and priority, and
+// applying it with ApplyReview turns each row into a classifier rule.
+var pendingColumns = []string{"mechant", "category", "match", "priority", "suggestion", "confidence", "count", "total"}
+var pendingTypes = []string{"TEXT", "TEXT", "TEXT", "INTEGER", "TEXT", "REAL", "INTEGER", "REAL"}
+
+type pendingMechant struct {
+	mechant    string
+	suggestion Suggestion
+	count      int
+	total      money.Amount
+}
+
+type pendingReview struct {
+	mechants map[string]*pendingMechant
+}
+
+func newPendingReview() *pendingReview {
+	return &pendingReview{mechants: make(map[string]*pendingMechant)}
+}
+
+func (p *pendingReview) add(t Transaction, suggestions []Suggestion) {
+	m, ok := p.mechants[t.Mechant]
+	if !ok {
+		m = &pendingMechant{mechant: t.Mechant}
+		if len(suggestions) > 0 {
+			m.suggestion = suggestions[0]
+		}
+		p.mechants[t.Mechant] = m
+	}
+	m.count++
+	m.total += t.Amount
+}
+
+// write replaces fileName with the pending mechants, the most spent at
+// first.
+func (p *pendingReview) write(fileName string) error {
+	var list []*pendingMechant
+	for _, m := range p.mechants {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].total != list[j].total {
+			return list[i].total > list[j].total
+		}
+		return list[i].mechant < list[j].mechant
+	})
+
+	writer, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{
+		Separator:  ',',
+		WriteTo:    writer,
+		TimeFormat: TimeFormat,
+	})
+	err = csvOutput.WriteHeader(pendingTypes, pendingColumns)
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		confidence := ""
+		if m.suggestion.Category != "" {
+			confidence = strconv.FormatFloat(m.suggestion.Confidence, 'f', 2, 64)
+		}
+		err = csvOutput.WriteRow([]string{
+			m.mechant,
+			"",
+			MatchExact,
+			"0",
+			m.suggestion.Category,
+			confidence,
+			strconv.Itoa(m.count),
+			m.total.Text(money.MaxDigits),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return csvOutput.Flush()
+}
+
+// ApplyReview adds a classifier rule for every row of a filled in pending
+// review file that has a category, unless the classifier has it already,
+// and returns how many were added. The rules added before a row that
+// fails are kept and saved.
+func (ms *MoneySense) ApplyReview(fileName string) (int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	csvInput, err := input.NewCSVInput(&input.CSVInputOptions{
+		Separator:  ',',
+		ReadFrom:   f,
+		TimeFormat: TimeFormat,
+	})
+	if err != nil {
+		return 0, err
+	}
+	columns := csvInput.Columns()
+	mechantCol := columnIndex(columns, "mechant")
+	categoryCol := columnIndex(columns, "category")
+	matchCol := columnIndex(columns, "match")
+	priorityCol := columnIndex(columns, "priority")
+	if mechantCol < 0 || categoryCol < 0 {
+		return 0, fmt.Errorf("%v needs mechant and category columns", fileName)
+	}
+
+	var applied int
+	for row := csvInput.ReadRow(); row != nil; row = csvInput.ReadRow() {
+		mechant := field(row, mechantCol)
+		category := strings.TrimSpace(field(row, categoryCol))
+		if mechant == "" || category == "" {
+			continue
+		}
+		match := strings.TrimSpace(field(row, matchCol))
+		if match == "" {
+			match = MatchExact
+		}
+		priority := 0
+		if p := strings.TrimSpace(field(row, priorityCol)); p != "" {
+			priority, err = strconv.Atoi(p)
+			if err != nil {
+				err = fmt.Errorf("Bad priority %q for %v", p, mechant)
+				break
+			}
+		}
+		var exists bool
+		exists, err = ms.hasRule(match, mechant, category, priority)
+		if err != nil {
+			break
+		}
+		if exists {
+			continue
+		}
+		err = ms.AddRule(match, mechant, category, priority)
+		if err != nil {
+			break
+		}
+		applied++
+	}
+	if applied > 0 {
+		ms.saveClassifier()
+	}
+	return applied, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPendingReviewWrite(t *testing.T) {
+	p := newPendingReview()
+	p.add(Transaction{Mechant: "NETFLIX.COM", Amount: 159900}, []Suggestion{{"streaming", 0.875}})
+	p.add(Transaction{Mechant: "SAFEWAY", Amount: 200000}, nil)
+	p.add(Transaction{Mechant: "NETFLIX.COM", Amount: 159900}, []Suggestion{{"other", 0.5}})
+	p.add(Transaction{Mechant: "ALDI", Amount: 200000}, nil)
+
+	f, err := ioutil.TempFile("./", "pending.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	err = p.write(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The most spent first, the suggestion of the first transaction kept.
+	expected := `TEXT,TEXT,TEXT,INTEGER,TEXT,REAL,INTEGER,REAL
+mechant,category,match,priority,suggestion,confidence,count,total
+NETFLIX.COM,,exact,0,streaming,0.88,2,31.98
+ALDI,,exact,0,,,1,20
+SAFEWAY,,exact,0,,,1,20
+`
+	written, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, string(written))
+	}
+}
+
+func TestApplyReview(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		"classifier.csv": "TEXT,TEXT\nmechant,category\nSAFEWAY,grocery\n",
+		"review.csv":     "TEXT,TEXT,TEXT,INTEGER\nmechant,category,match,priority\nSAFEWAY,grocery,,\nNETFLIX,streaming,prefix,5\nALDI,,,\nSHELL,fuel,,high\nAPPLE,computer,,\n",
+	}, MoneySenseOptions{})
+	review := filepath.Join(filepath.Dir(ms.classifierPath), "review.csv")
+
+	// SAFEWAY is in the classifier already and ALDI has no category, the
+	// rules before the bad priority of SHELL are kept.
+	applied, err := ms.ApplyReview(review)
+	if err == nil || applied != 1 {
+		t.Errorf("ApplyReview() = %v, %v, expected 1 and an error", applied, err)
+	}
+	saved, err := ioutil.ReadFile(ms.classifierPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), "NETFLIX,streaming,prefix,5") {
+		t.Errorf("Expected the NETFLIX rule to be saved, got\n%v", string(saved))
+	}
+
+	// Applying it again adds nothing new.
+	applied, _ = ms.ApplyReview(review)
+	if applied != 0 {
+		t.Errorf("Expected no rules applied twice, got %v", applied)
+	}
+	var count int
+	err = ms.store.QueryRow(`SELECT COUNT(*) FROM "` + ms.classifier + `"`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 rules, got %v", count)
+	}
+}
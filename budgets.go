@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"./input"
+	"./money"
+	"./output"
+	"./storage"
+)
+
+// Budget periods, a budget limits the spending of a category in every
+// calendar month or in every week starting on Sunday.
+const (
+	BudgetMonthly = "month"
+	BudgetWeekly  = "week"
+)
+
+// What becomes of the money left in a budget at the end of a period: it
+// is dropped, carried over to the next period in full, or carried over up
+// to the cap of the budget. Overspending is carried over by both carry
+// rules.
+const (
+	RolloverReset = "reset"
+	RolloverCarry = "carry"
+	RolloverCap   = "cap"
+)
+
+// budgetColumns are the columns of the budgets table and its csv file.
+// Budgets without rollover and cap are reset every period.
+var budgetColumns = []string{"category", "period", "amount", "rollover", "cap"}
+var budgetTypes = []string{"TEXT", "TEXT", input.AmountType, "TEXT", input.AmountType}
+
+// Budget limits what is spent on a category, subcategories included, in
+// each period.
+type Budget struct {
+	Category string
+	Period   string
+	Amount   money.Amount
+	Rollover string
+	Cap      money.Amount
+}
+
+// BudgetStatus is how a budget stands on a day of its period.
+type BudgetStatus struct {
+	Budget
+	Start time.Time
+	End   time.Time
+	// Available is the amount of the budget with what was carried over
+	// and allocated to it.
+	Available money.Amount
+	// Spent is what was spent from the start of the period to the day.
+	Spent     money.Amount
+	Remaining money.Amount
+	// Projected is what will be spent by the end of the period if the
+	// spending goes on at the same pace.
+	Projected money.Amount
+}
+
+func (s BudgetStatus) Over() bool {
+	return s.Spent > s.Available
+}
+
+func (s BudgetStatus) OnPaceToOvershoot() bool {
+	return s.Projected > s.Available
+}
+
+// periodRange returns the first and last day of the period holding date.
+func periodRange(period string, date time.Time) (time.Time, time.Time, error) {
+	year, month, day := date.Date()
+	date = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	switch period {
+	case BudgetMonthly:
+		start := date.AddDate(0, 0, -day+1)
+		return start, start.AddDate(0, 1, -1), nil
+	case BudgetWeekly:
+		start := date.AddDate(0, 0, -int(date.Weekday()))
+		return start, start.AddDate(0, 0, 6), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("Unknown budget period %q", period)
+}
+
+func (ms *MoneySense) Budgets() ([]Budget, error) {
+	var result []Budget
+
+	query := fmt.Sprintf(`SELECT category, period, %v, IFNULL(rollover, ''), %v FROM "%v" ORDER BY rowid ASC`,
+		toMaxDigits("amount", ""), toMaxDigits("IFNULL(cap, 0)", ""), ms.budgets)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b Budget
+		err = rows.Scan(&b.Category, &b.Period, &b.Amount, &b.Rollover, &b.Cap)
+		if err != nil {
+			return nil, err
+		}
+		b.Amount = b.Amount.Rescale(money.MaxDigits, ms.digits())
+		b.Cap = b.Cap.Rescale(money.MaxDigits, ms.digits())
+		if b.Rollover == "" {
+			b.Rollover = RolloverReset
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// SetBudget replaces the budget of category.
+func (ms *MoneySense) SetBudget(b Budget) error {
+	if _, _, err := periodRange(b.Period, time.Now()); err != nil {
+		return err
+	}
+	if b.Amount <= 0 {
+		return errors.New("Budget amounts should be positive.")
+	}
+	switch b.Rollover {
+	case RolloverReset, RolloverCarry:
+	case RolloverCap:
+		if b.Cap <= 0 {
+			return errors.New("Capped rollover needs a positive cap.")
+		}
+	default:
+		return fmt.Errorf("Unknown rollover %q", b.Rollover)
+	}
+	query := fmt.Sprintf(`DELETE FROM "%v" WHERE category = ?`, ms.budgets)
+	_, err := ms.store.Exec(query, b.Category)
+	if err != nil {
+		return err
+	}
+	query = fmt.Sprintf(`INSERT INTO "%v"(category, period, amount, rollover, cap, %v) VALUES(?, ?, ?, ?, ?, ?)`, ms.budgets, storage.DigitsColumn)
+	_, err = ms.store.Exec(query, b.Category, b.Period, b.Amount, b.Rollover, b.Cap, ms.digits())
+	if err != nil {
+		return err
+	}
+	ms.saveBudgets()
+	return nil
+}
+
+func (ms *MoneySense) ClearBudget(category string) error {
+	query := fmt.Sprintf(`DELETE FROM "%v" WHERE category = ?`, ms.budgets)
+	result, err := ms.store.Exec(query, category)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("No budget for %v", category)
+	}
+	ms.saveBudgets()
+	return nil
+}
+
+// createTableFile starts a csv file at filePath holding only the header
+// of a table, unless there is one already.
+func createTableFile(filePath string, types []string, columns []string) error {
+	writer, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{
+		Separator:  ',',
+		WriteTo:    writer,
+		TimeFormat: TimeFormat,
+	})
+	err = csvOutput.WriteHeader(types, columns)
+	if err != nil {
+		return err
+	}
+	return csvOutput.Flush()
+}
+
+// saveBudgets writes the budgets back to their file, if they have one.
+func (ms *MoneySense) saveBudgets() {
+	if ms.budgetsPath == "" {
+		return
+	}
+	ms.saveTable(ms.budgets, ms.budgetsPath)
+}
+
+// BudgetStatus reports every budget for the period holding date. Budgets
+// that roll over are run as envelopes from the start of the history.
+func (ms *MoneySense) BudgetStatus(date time.Time) ([]BudgetStatus, error) {
+	var result []BudgetStatus
+
+	budgets, err := ms.Budgets()
+	if err != nil {
+		return nil, err
+	}
+	year, month, d := date.Date()
+	day := time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	for _, b := range budgets {
+		from := day
+		if first := ms.firstDate(day); b.Rollover != RolloverReset && first.Before(day) {
+			from = first
+		}
+		periods, err := ms.Envelope(b, from, day)
+		if err != nil {
+			return nil, err
+		}
+		p := periods[len(periods)-1]
+		s := BudgetStatus{
+			Budget:    b,
+			Start:     p.Start,
+			End:       p.End,
+			Available: p.Available(),
+			Spent:     p.Spent,
+			Remaining: p.Balance,
+		}
+		elapsed := day.Sub(p.Start).Hours()/24 + 1
+		days := p.End.Sub(p.Start).Hours()/24 + 1
+		s.Projected = s.Spent.Mul(days / elapsed)
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// parseBudget reads the "<category> <period> <amount> [rollover [cap]]"
+// arguments of the budget command, the amounts in minor units of digits
+// digits.
+func parseBudget(args []string, digits int) (Budget, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return Budget{}, errors.New("Require category, period, amount and optionally rollover and cap.")
+	}
+	amount, err := money.Parse(args[2], '.', digits)
+	if err != nil {
+		return Budget{}, fmt.Errorf("Bad amount %q", args[2])
+	}
+	b := Budget{Category: args[0], Period: args[1], Amount: amount, Rollover: RolloverReset}
+	if len(args) > 3 {
+		b.Rollover = args[3]
+	}
+	if len(args) > 4 {
+		b.Cap, err = money.Parse(args[4], '.', digits)
+		if err != nil {
+			return Budget{}, fmt.Errorf("Bad cap %q", args[4])
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodRange(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2020, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		period string
+		date   time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{BudgetMonthly, day(1, 1), day(1, 1), day(1, 31)},
+		{BudgetMonthly, day(1, 31), day(1, 1), day(1, 31)},
+		{BudgetMonthly, day(2, 15), day(2, 1), day(2, 29)},
+		{BudgetMonthly, day(12, 31), day(12, 1), day(12, 31)},
+		// Weeks run from Sunday to Saturday, 2020-03-01 is a Sunday.
+		{BudgetWeekly, day(3, 1), day(3, 1), day(3, 7)},
+		{BudgetWeekly, day(2, 29), day(2, 23), day(2, 29)},
+		{BudgetWeekly, day(3, 2), day(3, 1), day(3, 7)},
+		{BudgetWeekly, day(3, 7), day(3, 1), day(3, 7)},
+		{BudgetWeekly, day(3, 8), day(3, 8), day(3, 14)},
+		{BudgetWeekly, day(12, 31), day(12, 27), time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		// The time of day is dropped.
+		{BudgetWeekly, day(3, 7).Add(23 * time.Hour), day(3, 1), day(3, 7)},
+	}
+	for _, c := range cases {
+		start, end, err := periodRange(c.period, c.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !start.Equal(c.start) || !end.Equal(c.end) {
+			t.Errorf("periodRange(%v, %v) = %v - %v, expected %v - %v", c.period, c.date, start.Format(TimeFormat), end.Format(TimeFormat), c.start.Format(TimeFormat), c.end.Format(TimeFormat))
+		}
+	}
+	if _, _, err := periodRange("year", day(1, 1)); err == nil {
+		t.Errorf("Expected an unknown period to fail")
+	}
+}
+
+func TestBudgetStatusOver(t *testing.T) {
+	cases := []struct {
+		status BudgetStatus
+		over   bool
+		pace   bool
+	}{
+		{BudgetStatus{Available: 20000, Spent: 10000, Projected: 18000}, false, false},
+		{BudgetStatus{Available: 20000, Spent: 10000, Projected: 20001}, false, true},
+		{BudgetStatus{Available: 20000, Spent: 20000, Projected: 20000}, false, false},
+		{BudgetStatus{Available: 20000, Spent: 20001, Projected: 30000}, true, true},
+		// Overspending carried over leaves nothing available.
+		{BudgetStatus{Available: -5000, Spent: 0, Projected: 0}, true, true},
+	}
+	for _, c := range cases {
+		if c.status.Over() != c.over || c.status.OnPaceToOvershoot() != c.pace {
+			t.Errorf("%+v: expected over %v and on pace %v", c.status, c.over, c.pace)
+		}
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	b, err := parseBudget([]string{"food", "month", "200.50"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != (Budget{Category: "food", Period: BudgetMonthly, Amount: 20050, Rollover: RolloverReset}) {
+		t.Errorf("Unexpected budget %+v", b)
+	}
+	for _, args := range [][]string{{"food", "month"}, {"food", "month", "1.234"}} {
+		if _, err := parseBudget(args, 2); err == nil {
+			t.Errorf("Expected parseBudget(%v) to fail", args)
+		}
+	}
+}
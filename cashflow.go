@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+
+	"./money"
+)
+
+// CashFlowPeriod is what came in and went out in one period. Transfers
+// are the net of the money moved to other accounts of ours, they count
+// neither as income nor as expenses.
+type CashFlowPeriod struct {
+	Start     time.Time
+	Income    money.Amount
+	Expenses  money.Amount
+	Transfers money.Amount
+}
+
+// Savings is the income left after the expenses.
+func (p CashFlowPeriod) Savings() money.Amount {
+	return p.Income - p.Expenses
+}
+
+// CashFlow sums the income and expenses between start and end by week or
+// month.
+func (ms *MoneySense) CashFlow(start string, end string, period string) ([]CashFlowPeriod, error) {
+	var result []CashFlowPeriod
+
+	// Check the period even when there is nothing to sum up by it.
+	_, _, err := periodRange(period, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[time.Time]int)
+	for _, r := range ms.Flows(start, end) {
+		periodStart, _, err := periodRange(period, r.Date)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[periodStart]
+		if !ok {
+			i = len(result)
+			index[periodStart] = i
+			result = append(result, CashFlowPeriod{Start: periodStart})
+		}
+		switch r.Kind {
+		case KindIncome:
+			result[i].Income -= r.Amount
+		case KindExpense:
+			result[i].Expenses += r.Amount
+		case KindTransfer:
+			result[i].Transfers += r.Amount
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"./money"
+)
+
+// CategorySeparator separates the levels of a category path such as
+// "Food:Restaurants:Coffee".
+const CategorySeparator = ":"
+
+func categoryPath(category string) []string {
+	parts := strings.Split(category, CategorySeparator)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+func categoryDepth(category string) int {
+	return len(categoryPath(category))
+}
+
+// categoryAtDepth rolls category up to its ancestor depth levels from the
+// top. A depth of zero, or deeper than the category, keeps it as it is.
+func categoryAtDepth(category string, depth int) string {
+	parts := categoryPath(category)
+	if depth <= 0 || depth >= len(parts) {
+		return strings.Join(parts, CategorySeparator)
+	}
+	return strings.Join(parts[:depth], CategorySeparator)
+}
+
+// inCategory reports whether category is root or one of its descendants.
+// The root "*" holds every category.
+func inCategory(category string, root string) bool {
+	if root == "*" {
+		return true
+	}
+	c := strings.Join(categoryPath(category), CategorySeparator)
+	r := strings.Join(categoryPath(root), CategorySeparator)
+	return c == r || strings.HasPrefix(c, r+CategorySeparator)
+}
+
+// CategoryNode is a category of the tree with the amount booked on it
+// directly and the total of its whole subtree.
+type CategoryNode struct {
+	Name     string
+	Path     string
+	Amount   money.Amount
+	Total    money.Amount
+	Children []*CategoryNode
+}
+
+// buildCategoryTree arranges the amounts of categories in a tree whose
+// totals roll child amounts up into their parents.
+func buildCategoryTree(amounts map[string]money.Amount) *CategoryNode {
+	root := &CategoryNode{Name: "*", Path: "*"}
+	for category, amount := range amounts {
+		node := root
+		for i, name := range categoryPath(category) {
+			var child *CategoryNode
+			for _, c := range node.Children {
+				if c.Name == name {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				path := name
+				if i > 0 {
+					path = node.Path + CategorySeparator + name
+				}
+				child = &CategoryNode{Name: name, Path: path}
+				node.Children = append(node.Children, child)
+			}
+			child.Total += amount
+			node = child
+		}
+		node.Amount += amount
+		root.Total += amount
+	}
+	root.sort()
+	return root
+}
+
+func (n *CategoryNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Total > n.Children[j].Total
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// find returns the node of category, or nil if it is not in the tree.
+func (n *CategoryNode) find(category string) *CategoryNode {
+	if category == "*" {
+		return n
+	}
+	node := n
+	for _, name := range categoryPath(category) {
+		var next *CategoryNode
+		for _, c := range node.Children {
+			if c.Name == name {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// percentOf returns the share of total amount is, in percent. Refunds can
+// cancel out the spending, there is no share of nothing.
+func percentOf(amount money.Amount, total money.Amount) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(amount) / float64(total) * 100
+}
+
+func (n *CategoryNode) print(indent int, total money.Amount, digits int) {
+	for _, c := range n.Children {
+		name := strings.Repeat("  ", indent) + c.Name
+		fmt.Printf("|%-32s|%%%-15.2f|$%-16v\n", name, percentOf(c.Total, total), c.Total.Format(digits))
+		c.print(indent+1, total, digits)
+	}
+}
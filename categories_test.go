@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	"./money"
+)
+
+func TestCategoryAtDepth(t *testing.T) {
+	cases := []struct {
+		category string
+		depth    int
+		expected string
+	}{
+		{"Food:Restaurants:Coffee", 0, "Food:Restaurants:Coffee"},
+		{"Food:Restaurants:Coffee", 1, "Food"},
+		{"Food:Restaurants:Coffee", 2, "Food:Restaurants"},
+		{"Food:Restaurants:Coffee", 5, "Food:Restaurants:Coffee"},
+		{"Food : Restaurants", 1, "Food"},
+		{"Food : Restaurants", 0, "Food:Restaurants"},
+		{"", 1, ""},
+	}
+	for _, c := range cases {
+		if category := categoryAtDepth(c.category, c.depth); category != c.expected {
+			t.Errorf("categoryAtDepth(%q, %v) = %q, expected %q", c.category, c.depth, category, c.expected)
+		}
+	}
+}
+
+func TestInCategory(t *testing.T) {
+	cases := []struct {
+		category string
+		root     string
+		expected bool
+	}{
+		{"Food", "Food", true},
+		{"Food:Restaurants", "Food", true},
+		{"Food : Restaurants", "Food:Restaurants", true},
+		{"Foodstuff", "Food", false},
+		{"Food", "Food:Restaurants", false},
+		{"Travel", "*", true},
+		{"", "*", true},
+	}
+	for _, c := range cases {
+		if inCategory(c.category, c.root) != c.expected {
+			t.Errorf("inCategory(%q, %q) should be %v", c.category, c.root, c.expected)
+		}
+	}
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	tree := buildCategoryTree(map[string]money.Amount{
+		"Food":                    1000,
+		"Food:Restaurants":        2000,
+		"Food:Restaurants:Coffee": 500,
+		"Food:Grocery":            4000,
+		"Travel":                  3000,
+	})
+	if tree.Total != 10500 {
+		t.Errorf("Expected a total of 10500, got %v", tree.Total)
+	}
+	cases := []struct {
+		category string
+		amount   money.Amount
+		total    money.Amount
+		children []string
+	}{
+		{"Food", 1000, 7500, []string{"Grocery", "Restaurants"}},
+		{"Food:Restaurants", 2000, 2500, []string{"Coffee"}},
+		{"Food:Restaurants:Coffee", 500, 500, nil},
+		{"Travel", 3000, 3000, nil},
+	}
+	for _, c := range cases {
+		node := tree.find(c.category)
+		if node == nil {
+			t.Errorf("No node for %v", c.category)
+			continue
+		}
+		if node.Path != c.category || node.Amount != c.amount || node.Total != c.total || len(node.Children) != len(c.children) {
+			t.Errorf("Unexpected node %+v for %v", node, c.category)
+			continue
+		}
+		// Children come by total, the largest first.
+		for i, name := range c.children {
+			if node.Children[i].Name != name {
+				t.Errorf("Expected child %v of %v to be %v, got %v", i, c.category, name, node.Children[i].Name)
+			}
+		}
+	}
+	if tree.find("*") != tree || tree.find("Food:Takeout") != nil {
+		t.Errorf("Unexpected find results")
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	cases := []struct {
+		amount   money.Amount
+		total    money.Amount
+		expected float64
+	}{
+		{2500, 10000, 25},
+		{-2500, 10000, -25},
+		{10000, 10000, 100},
+		// Refunds that cancel out the spending leave no total to share.
+		{2500, 0, 0},
+		{0, 0, 0},
+	}
+	for _, c := range cases {
+		if p := percentOf(c.amount, c.total); p != c.expected {
+			t.Errorf("percentOf(%v, %v) = %v, expected %v", c.amount, c.total, p, c.expected)
+		}
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"./input"
+	"./money"
+	"./output"
 )
 
 type TimeUnit uint8
@@ -22,30 +29,226 @@ const (
 func main() {
 	var historyPath = flag.String("d", "./", "path for history csv records.")
 	var classifierPath = flag.String("c", "./", "path for classifier.")
+	var budgetsPath = flag.String("b", "", "path for budgets csv, kept in the database only if empty.")
+	var accountsPath = flag.String("a", "", "path for the accounts registry csv, kept in the database only if empty.")
+	var dbPath = flag.String("db", "", "path for a persistent SQLite database, kept in memory if empty.")
+	var profilesPath = flag.String("p", "", "path for bank import profiles.")
+	var batch = flag.Bool("batch", false, "classify without asking, write unknown mechants for review and exit.")
+	var pendingPath = flag.String("pending", "pending.csv", "path for the mechants a batch run could not classify.")
+	var uncategorized = flag.String("uncategorized", "", "category for transactions no rule matches, left out if empty.")
+	var transferDays = flag.Int("transfer-days", 3, "how many days apart the two sides of a transfer between accounts may be.")
+	var base = flag.String("base", "", "currency to convert reports into, and of the accounts with none of their own.")
+	var ratesPath = flag.String("rates", "", "path for the exchange rates csv of date, pair and rate.")
+	var applyPath = flag.String("apply", "", "path of a filled in pending review file to add to the classifier.")
+	var scriptPath = flag.String("script", "", "path of a file of commands to run one per line and exit, - for stdin.")
+	var format = flag.String("o", FormatTable, "format of the pc, hd, hw and hm reports, table, json or csv.")
 	flag.Parse()
 
-	ms, err := NewMoneySense(*historyPath, *classifierPath)
+	var err error
+	reportFormat, err = parseFormat(*format)
 	if err != nil {
-		log.Fatal("Could not initiate MoneySense!")
+		log.Fatal(err)
+	}
+
+	// Commands given as arguments or in a script run without asking
+	// anything, the history and classifier reports then go to stderr so
+	// that stdout only holds the results.
+	scripted := flag.NArg() > 0 || *scriptPath != ""
+	stdout := os.Stdout
+	if scripted {
+		os.Stdout = os.Stderr
+	}
+
+	opts := &MoneySenseOptions{
+		HistoryPath:    *historyPath,
+		ClassifierPath: *classifierPath,
+		BudgetsPath:    *budgetsPath,
+		AccountsPath:   *accountsPath,
+		DBPath:         *dbPath,
+		Batch:          *batch || scripted,
+		Uncategorized:  *uncategorized,
+		TransferDays:   *transferDays,
+		Base:           *base,
+		RatesPath:      *ratesPath,
+	}
+	// Scripted runs leave the pending review file alone, it may hold
+	// answers not applied yet.
+	if *batch {
+		opts.PendingPath = *pendingPath
+	}
+	if *profilesPath != "" {
+		profiles, err := input.LoadProfilesFile(*profilesPath)
+		if err != nil {
+			log.Fatal("Could not load import profiles!", err)
+		}
+		opts.Profiles = profiles
+	}
+
+	ms, err := NewMoneySense(opts)
+	if err != nil {
+		log.Fatal("Could not initiate MoneySense!", err)
+	}
+
+	if *applyPath != "" {
+		applied, err := ms.ApplyReview(*applyPath)
+		fmt.Printf("Added %v rules from %v\n", applied, *applyPath)
+		if err != nil {
+			log.Fatal("Could not apply review!", err)
+		}
+		ms.Close()
+		os.Exit(0)
 	}
 
-	err = ms.Classify()
+	summary, err := ms.Classify()
 	if err != nil {
 		log.Fatal("Could not classify records!", err)
 	}
+	if !*batch && summary.Pending > 0 {
+		fmt.Printf("%v mechants left unclassified, review them with -batch\n", summary.Pending)
+	}
+	if *batch {
+		fmt.Printf("Classified %v of %v transactions, learned %v mechants, %v mechants pending review in %v\n",
+			summary.Classified, summary.Transactions, summary.Learned, summary.Pending, *pendingPath)
+		ms.Close()
+		if summary.Pending > 0 {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
+	matched, ambiguous, err := ms.MatchTransfers(*transferDays)
+	if err != nil {
+		log.Fatal("Could not match transfers!", err)
+	}
+	if matched > 0 || len(ambiguous) > 0 {
+		fmt.Printf("Matched %v transfers between accounts, %v pairs to confirm or reject with transfers\n", matched, len(ambiguous))
+	}
+
+	if scripted {
+		os.Stdout = stdout
+		if flag.NArg() > 0 {
+			err = runCommand(strings.Join(flag.Args(), " "), ms)
+		} else {
+			err = runScript(*scriptPath, ms)
+		}
+		ms.Close()
+		if err != nil && err != errExit {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
-	reader := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print("$ ")
-		cmdString, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+		cmdString, readErr := stdin.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			fmt.Fprintln(os.Stderr, readErr)
+			break
 		}
 		err = runCommand(cmdString, ms)
+		if err == errExit {
+			break
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 		}
+		if readErr == io.EOF {
+			fmt.Println()
+			break
+		}
 	}
+	ms.Close()
+}
+
+// stdin is shared by the classify prompt and the command prompt, so that
+// neither buffers input meant for the other.
+var stdin = bufio.NewReader(os.Stdin)
+
+// Formats of the pc, hd, hw and hm reports, picked with the -o flag and
+// the format command: fixed width tables, or JSON and CSV for other
+// programs to read.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+var reportFormat = FormatTable
+
+func parseFormat(s string) (string, error) {
+	switch s {
+	case FormatTable, FormatJSON, FormatCSV:
+		return s, nil
+	}
+	return "", fmt.Errorf("Unknown format %q, use table, json or csv", s)
+}
+
+// rowOutput writes a report as rows of columns.
+type rowOutput interface {
+	WriteHeader(types []string, columns []string) error
+	WriteRow(values []string) error
+	Flush() error
+}
+
+// reportOutput returns where reports go in the current format, nil for
+// tables.
+func reportOutput() rowOutput {
+	switch reportFormat {
+	case FormatJSON:
+		return output.NewJSONOutput(&output.JSONOutputOptions{WriteTo: os.Stdout, Indent: "  "})
+	case FormatCSV:
+		return output.NewCSVOutput(&output.CSVOutputOptions{Separator: ',', WriteTo: os.Stdout, TimeFormat: TimeFormat, OmitTypes: true})
+	}
+	return nil
+}
+
+// writeReport writes rows with the header of types and columns to out.
+func writeReport(out rowOutput, types []string, columns []string, rows [][]string) error {
+	err := out.WriteHeader(types, columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err = out.WriteRow(row)
+		if err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// errExit is returned by the exit command.
+var errExit = errors.New("exit")
+
+// runScript runs the commands of the file at path, or of stdin if it is
+// "-", one per line, stopping at the first that fails. Blank lines and
+// lines starting with # are skipped.
+func runScript(path string, ms *MoneySense) error {
+	var r io.Reader = stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		cmdString := strings.TrimSpace(scanner.Text())
+		if cmdString == "" || strings.HasPrefix(cmdString, "#") {
+			continue
+		}
+		err := runCommand(cmdString, ms)
+		if err == errExit {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", path, line, err)
+		}
+	}
+	return scanner.Err()
 }
 
 func runCommand(commandStr string, ms *MoneySense) error {
@@ -53,65 +256,899 @@ func runCommand(commandStr string, ms *MoneySense) error {
 	if len(commandStr) == 0 {
 		return nil
 	}
-	arrCommandStr := strings.Fields(commandStr)
+	// "@name" arguments narrow the command down to the named accounts.
+	arrCommandStr, accounts := splitAccountFilter(strings.Fields(commandStr))
+	if len(arrCommandStr) == 0 {
+		return errors.New("Require a command.")
+	}
+	ms.accountFilter = accounts
+	defer func() { ms.accountFilter = nil }()
 	switch arrCommandStr[0] {
 	case "exit":
-		os.Exit(0)
+		return errExit
+	case "format":
+		if len(arrCommandStr) < 2 {
+			fmt.Println(reportFormat)
+			return nil
+		}
+		format, err := parseFormat(arrCommandStr[1])
+		if err != nil {
+			return err
+		}
+		reportFormat = format
 	case "pc":
 		if len(arrCommandStr) < 3 {
 			return errors.New("Require 2 arguments specifying date range.")
 		}
-		printCategoryPercentage(arrCommandStr[1], arrCommandStr[2], ms)
+		depth, err := depthArg(arrCommandStr, 3)
+		if err != nil {
+			return err
+		}
+		root := "*"
+		if len(arrCommandStr) > 4 {
+			root = strings.Join(arrCommandStr[4:], " ")
+		}
+		return printCategoryPercentage(arrCommandStr[1], arrCommandStr[2], ms, depth, root)
 	case "hd":
 		if len(arrCommandStr) < 4 {
 			return errors.New("Require 3 arguments specifying category and date range.")
 		}
-		printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByDate)
+		depth, err := depthArg(arrCommandStr, 4)
+		if err != nil {
+			return err
+		}
+		return printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByDate, depth)
 	case "hw":
 		if len(arrCommandStr) < 4 {
 			return errors.New("Require 3 arguments specifying category and date range.")
 		}
-		printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByWeek)
+		depth, err := depthArg(arrCommandStr, 4)
+		if err != nil {
+			return err
+		}
+		return printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByWeek, depth)
 	case "hm":
 		if len(arrCommandStr) < 4 {
 			return errors.New("Require 3 arguments specifying category and date range.")
 		}
-		printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByMonth)
+		depth, err := depthArg(arrCommandStr, 4)
+		if err != nil {
+			return err
+		}
+		return printHistory(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms, ByMonth, depth)
+	case "tree":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range.")
+		}
+		root := "*"
+		if len(arrCommandStr) > 3 {
+			root = strings.Join(arrCommandStr[3:], " ")
+		}
+		return printCategoryTree(arrCommandStr[1], arrCommandStr[2], ms, root)
+	case "dups":
+		days := 3
+		if len(arrCommandStr) > 1 {
+			n, err := strconv.Atoi(arrCommandStr[1])
+			if err != nil {
+				return errors.New("Require the number of days as argument.")
+			}
+			days = n
+		}
+		printNearDuplicates(days, ms)
+	case "dropdup":
+		if len(arrCommandStr) < 2 {
+			return errors.New("Require 1 argument specifying the transaction to drop.")
+		}
+		return ms.DropTransaction(arrCommandStr[1])
+	case "keepdup":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying the transactions to keep.")
+		}
+		return ms.KeepPair(arrCommandStr[1], arrCommandStr[2])
+	case "rules":
+		return printRules(ms)
+	case "rule":
+		if len(arrCommandStr) < 5 {
+			return errors.New("Require 4 arguments specifying match, category, priority and pattern.")
+		}
+		priority, err := strconv.Atoi(arrCommandStr[3])
+		if err != nil {
+			return errors.New("Priority should be an integer.")
+		}
+		pattern := strings.Join(arrCommandStr[4:], " ")
+		err = ms.AddRule(arrCommandStr[1], pattern, arrCommandStr[2], priority)
+		if err != nil {
+			return err
+		}
+		ms.saveClassifier()
+	case "tx":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range.")
+		}
+		return printTransactions(arrCommandStr[1], arrCommandStr[2], strings.Join(arrCommandStr[3:], " "), ms)
+	case "split":
+		if len(arrCommandStr) < 4 {
+			return errors.New("Require a transaction and pairs of category and amount.")
+		}
+		parts, err := parseSplits(arrCommandStr[2:])
+		if err != nil {
+			return err
+		}
+		return ms.SetSplits(arrCommandStr[1], parts)
+	case "unsplit":
+		if len(arrCommandStr) < 2 {
+			return errors.New("Require 1 argument specifying the transaction.")
+		}
+		return ms.ClearSplits(arrCommandStr[1])
+	case "splits":
+		printSplits(ms)
+	case "overrides":
+		return printOverrides(ms)
+	case "override":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying transaction and category.")
+		}
+		return ms.SetOverride(arrCommandStr[1], strings.Join(arrCommandStr[2:], " "))
+	case "unoverride":
+		if len(arrCommandStr) < 2 {
+			return errors.New("Require 1 argument specifying the transaction.")
+		}
+		return ms.ClearOverride(arrCommandStr[1])
+	case "qif":
+		if len(arrCommandStr) < 4 {
+			return errors.New("Require 3 arguments specifying file and date range.")
+		}
+		return ms.ExportQIF(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3])
+	case "budgets":
+		date := time.Now()
+		if len(arrCommandStr) > 1 {
+			d, err := time.Parse(TimeFormat, arrCommandStr[1])
+			if err != nil {
+				return fmt.Errorf("Failed to parse date: %v", arrCommandStr[1])
+			}
+			date = d
+		}
+		return printBudgets(date, ms)
+	case "subs":
+		date := time.Now()
+		if len(arrCommandStr) > 1 {
+			d, err := time.Parse(TimeFormat, arrCommandStr[1])
+			if err != nil {
+				return fmt.Errorf("Failed to parse date: %v", arrCommandStr[1])
+			}
+			date = d
+		}
+		return printSubscriptions(date, ms)
+	case "alerts":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range, and optionally a csv file to export to.")
+		}
+		fileName := ""
+		if len(arrCommandStr) > 3 {
+			fileName = arrCommandStr[3]
+		}
+		return printAlerts(arrCommandStr[1], arrCommandStr[2], fileName, ms)
+	case "fc":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date and months to project, and optionally the category depth.")
+		}
+		date, err := time.Parse(TimeFormat, arrCommandStr[1])
+		if err != nil {
+			return fmt.Errorf("Failed to parse date: %v", arrCommandStr[1])
+		}
+		months, err := strconv.Atoi(arrCommandStr[2])
+		if err != nil || months < 0 {
+			return fmt.Errorf("Bad number of months %q", arrCommandStr[2])
+		}
+		depth, err := depthArg(arrCommandStr, 3)
+		if err != nil {
+			return err
+		}
+		return printForecast(date, months, depth, ms)
+	case "goals":
+		date := time.Now()
+		if len(arrCommandStr) > 1 {
+			d, err := time.Parse(TimeFormat, arrCommandStr[1])
+			if err != nil {
+				return fmt.Errorf("Failed to parse date: %v", arrCommandStr[1])
+			}
+			date = d
+		}
+		return printGoals(date, ms)
+	case "goal":
+		if len(accounts) > 1 {
+			return errors.New("A goal is funded by one account.")
+		}
+		account, digits := "", ms.digits()
+		if len(accounts) == 1 {
+			account, digits = accounts[0], ms.accountDigits(accounts[0])
+		}
+		g, err := parseGoal(arrCommandStr[1:], account, digits)
+		if err != nil {
+			return err
+		}
+		return ms.SetGoal(g)
+	case "ungoal":
+		if len(arrCommandStr) < 2 {
+			return errors.New("Require 1 argument specifying the goal.")
+		}
+		return ms.ClearGoal(arrCommandStr[1])
+	case "budget":
+		b, err := parseBudget(arrCommandStr[1:], ms.digits())
+		if err != nil {
+			return err
+		}
+		return ms.SetBudget(b)
+	case "unbudget":
+		if len(arrCommandStr) < 2 {
+			return errors.New("Require 1 argument specifying the category.")
+		}
+		return ms.ClearBudget(arrCommandStr[1])
+	case "accounts":
+		return printAccounts(ms)
+	case "account":
+		a, err := parseAccount(arrCommandStr[1:])
+		if err != nil {
+			return err
+		}
+		return ms.SetAccount(a)
+	case "opening":
+		if len(arrCommandStr) < 4 {
+			return errors.New("Require 3 arguments specifying account, balance and date.")
+		}
+		amount, err := money.Parse(arrCommandStr[2], '.', ms.accountDigits(arrCommandStr[1]))
+		if err != nil {
+			return fmt.Errorf("Bad balance %q", arrCommandStr[2])
+		}
+		date, err := time.Parse(TimeFormat, arrCommandStr[3])
+		if err != nil {
+			return fmt.Errorf("Failed to parse date: %v", arrCommandStr[3])
+		}
+		return ms.SetOpening(arrCommandStr[1], amount, date)
+	case "balance":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range.")
+		}
+		return printBalances(arrCommandStr[1], arrCommandStr[2], ms)
+	case "reconcile":
+		if len(arrCommandStr) == 2 {
+			return printReconciliations(arrCommandStr[1], ms)
+		}
+		account, date, balance, err := parseReconcile(arrCommandStr[1:], ms.accountDigits)
+		if err != nil {
+			return err
+		}
+		return printReconcile(account, date, balance, ms)
+	case "transfers":
+		days := ms.transferDays
+		if len(arrCommandStr) > 1 {
+			d, err := strconv.Atoi(arrCommandStr[1])
+			if err != nil {
+				return err
+			}
+			days = d
+		}
+		return printTransfers(days, ms)
+	case "confirm":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying the transactions.")
+		}
+		return ms.ConfirmTransfer(arrCommandStr[1], arrCommandStr[2])
+	case "reject":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying the transactions.")
+		}
+		return ms.RejectTransfer(arrCommandStr[1], arrCommandStr[2])
+	case "kinds":
+		return printKinds(ms)
+	case "kind":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying category and kind.")
+		}
+		return ms.SetKind(arrCommandStr[1], arrCommandStr[2])
+	case "cf":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range.")
+		}
+		period := BudgetMonthly
+		if len(arrCommandStr) > 3 {
+			period = arrCommandStr[3]
+		}
+		return printCashFlow(arrCommandStr[1], arrCommandStr[2], period, ms)
+	case "allocate":
+		a, err := parseAllocation(arrCommandStr[1:], ms.digits())
+		if err != nil {
+			return err
+		}
+		return ms.Allocate(a)
+	case "allocations":
+		if len(arrCommandStr) < 3 {
+			return errors.New("Require 2 arguments specifying date range.")
+		}
+		return printAllocations(arrCommandStr[1], arrCommandStr[2], ms)
+	case "envelope":
+		if len(arrCommandStr) < 4 {
+			return errors.New("Require 3 arguments specifying category and date range.")
+		}
+		return printEnvelope(arrCommandStr[1], arrCommandStr[2], arrCommandStr[3], ms)
+	default:
+		return fmt.Errorf("Unknown command %v", arrCommandStr[0])
+	}
+	return nil
+}
+
+func printTransactions(start string, end string, pattern string, ms *MoneySense) error {
+	transactions, err := ms.Transactions(start, end, pattern)
+	if err != nil {
+		return err
+	}
+	splits := ms.loadSplits()
+	transfers := ms.transferIDs()
+	fmt.Printf("|%-16s|%-12s|%-10s|%-24s|%-10s|%-14s|%-16s\n", "ID", "Account", "Date", "Mechant", "Amount", "Original", "Category")
+	fmt.Println("-----------------------------------------------------------------------------------------------------------")
+	for _, t := range transactions {
+		category := t.Category
+		if t.Overridden {
+			category += " (override)"
+		}
+		if len(splits[t.ID]) > 0 {
+			category += " (split)"
+		}
+		if transfers[t.ID] {
+			category += " (transfer)"
+		}
+		original := t.Original.Format(money.Digits(t.Currency)) + " " + t.Currency
+		fmt.Printf("|%-16v|%-12v|%-10v|%-24v|$%-9v|%-14v|%-16v\n", t.ID, t.Account, t.Date.Format(TimeFormat), t.Mechant, t.Amount.Format(ms.digits()), original, category)
 	}
 	return nil
 }
 
-func printCategoryPercentage(start string, end string, ms *MoneySense) error {
-	var total float64
+func printSplits(ms *MoneySense) {
+	fmt.Printf("|%-16s|%-16s|%-10s\n", "ID", "Category", "Amount")
+	fmt.Println("---------------------------------------------")
+	for _, parts := range ms.loadSplits() {
+		for _, p := range parts {
+			fmt.Printf("|%-16v|%-16v|%-10v\n", p.ID, p.Category, p.Amount.Text(money.MaxDigits))
+		}
+	}
+}
 
-	var m = make(map[string]float64)
+// printBudgets compares the budgets with what was spent in their period
+// holding date, flagging the ones over budget or on pace to be.
+func printBudgets(date time.Time, ms *MoneySense) error {
+	statuses, err := ms.BudgetStatus(date)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("|%-16s|%-6s|%-10s|%-10s|%-10s|%-10s|%-10s|%-10s|%v\n", "Category", "Period", "Start", "Budget", "Available", "Spent", "Remaining", "Projected", "Status")
+	fmt.Println("----------------------------------------------------------------------------------------------------")
+	for _, s := range statuses {
+		status := ""
+		if s.Over() {
+			status = "OVER"
+		} else if s.OnPaceToOvershoot() {
+			status = "ON PACE TO OVERSHOOT"
+		}
+		d := ms.digits()
+		fmt.Printf("|%-16v|%-6v|%-10v|$%-9v|$%-9v|$%-9v|$%-9v|$%-9v|%v\n",
+			s.Category, s.Period, s.Start.Format(TimeFormat), s.Amount.Format(d), s.Available.Format(d), s.Spent.Format(d), s.Remaining.Format(d), s.Projected.Format(d), status)
+	}
+	return nil
+}
 
-	records := ms.Retrieve("*", start, end)
-	for _, r := range records {
-		m[r.Category] += r.Amount
+// printSubscriptions lists the recurring charges as of date with what
+// they cost in a year, flagging price increases and late or missed
+// charges.
+func printSubscriptions(date time.Time, ms *MoneySense) error {
+	subs, err := ms.Subscriptions(date)
+	if err != nil {
+		return err
+	}
+	d := ms.digits()
+	var annual money.Amount
+	fmt.Printf("|%-24s|%-16s|%-8s|%-7s|%-10s|%-10s|%-10s|%-10s|%v\n", "Mechant", "Category", "Cadence", "Charges", "Amount", "Last", "Next", "Annual", "Flags")
+	fmt.Println("----------------------------------------------------------------------------------------------------------")
+	for _, s := range subs {
+		var flags []string
+		if s.PriceIncrease() {
+			flags = append(flags, "PRICE UP from $"+s.Previous.Format(d))
+		}
+		if s.Late {
+			flags = append(flags, "LATE")
+		}
+		if s.Missed {
+			flags = append(flags, "MISSED")
+		}
+		fmt.Printf("|%-24v|%-16v|%-8v|%-7v|$%-9v|%-10v|%-10v|$%-9v|%v\n",
+			s.Mechant, s.Category, s.Cadence, s.Charges, s.Amount.Format(d), s.Last.Format(TimeFormat), s.Next.Format(TimeFormat), s.Annual().Format(d), strings.Join(flags, ", "))
+		annual += s.Annual()
+	}
+	fmt.Printf("%v recurring charges, $%v a year\n", len(subs), annual.Format(d))
+	return nil
+}
+
+// printAlerts lists the transactions between start and end that are out
+// of character, and writes them to fileName too if it is set.
+func printAlerts(start string, end string, fileName string, ms *MoneySense) error {
+	startDate, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", start)
+	}
+	endDate, err := time.Parse(TimeFormat, end)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", end)
+	}
+	alerts, err := ms.Alerts(startDate, endDate)
+	if err != nil {
+		return err
+	}
+	d := ms.digits()
+	fmt.Printf("|%-16s|%-10s|%-24s|%-10s|%-9s|%v\n", "ID", "Date", "Mechant", "Amount", "Kind", "Reason")
+	fmt.Println("--------------------------------------------------------------------------------------------")
+	for _, a := range alerts {
+		fmt.Printf("|%-16v|%-10v|%-24v|$%-9v|%-9v|%v\n", a.ID, a.Date.Format(TimeFormat), a.Mechant, a.Amount.Format(d), a.Kind, a.Reason)
+	}
+	if fileName != "" {
+		err = ms.ExportAlerts(alerts, fileName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %v alerts to %v\n", len(alerts), fileName)
+	}
+	return nil
+}
+
+// printForecast lists the projected spending of every category for the
+// month holding date and the months next ones, and plots it against what
+// was spent.
+func printForecast(date time.Time, months int, depth int, ms *MoneySense) error {
+	forecasts, err := ms.Forecast(date, months, depth)
+	if err != nil {
+		return err
+	}
+	if len(forecasts) == 0 {
+		return errors.New("No spending to forecast from.")
+	}
+	err = plotForecast(forecasts, ms.digits())
+	if err != nil {
+		return err
+	}
+
+	d := ms.digits()
+	var spent, endOfMonth money.Amount
+	fmt.Printf("|%-16s|%-10s|%-10s|%-10s|%-10s|%-10s|%-10s\n", "Category", "Month", "Actual", "Projected", "Low", "High", "Recurring")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, f := range forecasts {
+		for _, m := range f.Months[f.Past:] {
+			fmt.Printf("|%-16v|%-10v|$%-9v|$%-9v|$%-9v|$%-9v|$%-9v\n", categoryName(f.Category), m.Start.Format("01/2006"),
+				m.Actual.Format(d), m.Projected.Format(d), m.Low.Format(d), m.High.Format(d), m.Recurring.Format(d))
+		}
+		spent += f.Current().Actual
+		endOfMonth += f.Current().Projected
+	}
+	fmt.Printf("Spent $%v by %v, $%v projected by the end of the month\n", spent.Format(d), date.Format(TimeFormat), endOfMonth.Format(d))
+	return nil
+}
+
+// printGoals lists the progress of the goals as of date and plots what
+// was saved for them.
+func printGoals(date time.Time, ms *MoneySense) error {
+	progress, err := ms.GoalProgress(date)
+	if err != nil {
+		return err
+	}
+	if len(progress) == 0 {
+		return errors.New("No goals.")
+	}
+	err = plotGoals(progress, ms.goalDigits)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("|%-16s|%-16s|%-10s|%-10s|%-10s|%-6s|%-10s|%-10s|%-10s|%v\n", "Goal", "Funded by", "Deadline", "Target", "Saved", "Done", "Rate", "Required", "Complete", "Status")
+	fmt.Println("------------------------------------------------------------------------------------------------------------------")
+	for _, p := range progress {
+		d := ms.goalDigits(p.Goal)
+		funding := p.Category
+		if p.Account != "" {
+			funding = "@" + p.Account
+		}
+		completion := "never"
+		if !p.Completion.IsZero() {
+			completion = p.Completion.Format(TimeFormat)
+		}
+		status := "BEHIND"
+		if p.Remaining() == 0 {
+			status = "REACHED"
+		} else if p.OnTrack() {
+			status = "ON TRACK"
+		}
+		fmt.Printf("|%-16v|%-16v|%-10v|$%-9v|$%-9v|%%%-5.0f|$%-9v|$%-9v|%-10v|%v\n", p.Name, funding, p.Deadline.Format(TimeFormat),
+			p.Target.Format(d), p.Saved.Format(d), float64(p.Saved)/float64(p.Target)*100, p.Rate.Format(d), p.Required.Format(d), completion, status)
+	}
+	return nil
+}
+
+// printCashFlow reports income, expenses and savings by period.
+func printCashFlow(start string, end string, period string, ms *MoneySense) error {
+	flows, err := ms.CashFlow(start, end, period)
+	if err != nil {
+		return err
+	}
+
+	var total CashFlowPeriod
+	d := ms.digits()
+	fmt.Printf("|%-10s|%-12s|%-12s|%-12s|%-12s\n", "Start", "Income", "Expenses", "Savings", "Transfers")
+	fmt.Println("-------------------------------------------------------------------")
+	for _, p := range flows {
+		fmt.Printf("|%-10v|$%-11v|$%-11v|$%-11v|$%-11v\n",
+			p.Start.Format(TimeFormat), p.Income.Format(d), p.Expenses.Format(d), p.Savings().Format(d), p.Transfers.Format(d))
+		total.Income += p.Income
+		total.Expenses += p.Expenses
+		total.Transfers += p.Transfers
+	}
+	fmt.Println("-------------------------------------------------------------------")
+	fmt.Printf("|%-10v|$%-11v|$%-11v|$%-11v|$%-11v\n",
+		"Total", total.Income.Format(d), total.Expenses.Format(d), total.Savings().Format(d), total.Transfers.Format(d))
+	return nil
+}
+
+// printTransfers matches transfers at most days apart and lists them with
+// the pairs that need the user to confirm or reject them.
+func printTransfers(days int, ms *MoneySense) error {
+	_, ambiguous, err := ms.MatchTransfers(days)
+	if err != nil {
+		return err
+	}
+	transfers, err := ms.Transfers()
+	if err != nil {
+		return err
+	}
+	printTransferPairs(transfers)
+	if len(ambiguous) > 0 {
+		fmt.Println("Ambiguous, confirm <out> <in> or reject <out> <in>:")
+		printTransferPairs(ambiguous)
+	}
+	return nil
+}
+
+func printTransferPairs(transfers []Transfer) {
+	fmt.Printf("|%-16s|%-12s|%-10s|%-16s|%-12s|%-10s|%-10s|%-10s\n", "Out", "Account", "Date", "In", "Account", "Date", "Amount", "Status")
+	fmt.Println("--------------------------------------------------------------------------------------------------------")
+	for _, t := range transfers {
+		amount := t.Out.Original.Format(money.Digits(t.Out.Currency)) + " " + t.Out.Currency
+		fmt.Printf("|%-16v|%-12v|%-10v|%-16v|%-12v|%-10v|%-10v|%-10v\n",
+			t.Out.ID, t.Out.Account, t.Out.Date.Format(TimeFormat), t.In.ID, t.In.Account, t.In.Date.Format(TimeFormat), amount, t.Status)
+	}
+}
+
+// printBalances plots the daily balances of the accounts filtered on, or
+// of all of them, and lists them on the days they changed.
+func printBalances(start string, end string, ms *MoneySense) error {
+	startDate, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", start)
+	}
+	endDate, err := time.Parse(TimeFormat, end)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", end)
+	}
+	names := ms.accountFilter
+	if len(names) == 0 {
+		accounts, err := ms.Accounts()
+		if err != nil {
+			return err
+		}
+		for _, a := range accounts {
+			names = append(names, a.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return errors.New("No accounts.")
+	}
+
+	balances := make(map[string][]Balance)
+	digits := make(map[string]int)
+	for _, name := range names {
+		balances[name], err = ms.Balances(name, startDate, endDate)
+		if err != nil {
+			return err
+		}
+		digits[name] = ms.accountDigits(name)
+	}
+	err = plotBalances(balances, digits)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("|%-10s", "Date")
+	for _, name := range names {
+		fmt.Printf("|%-12s", name)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 11+13*len(names)))
+	days := len(balances[names[0]])
+	for i := 0; i < days; i++ {
+		changed := i == 0 || i == days-1
+		for _, name := range names {
+			if i > 0 && balances[name][i].Amount != balances[name][i-1].Amount {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		fmt.Printf("|%-10v", balances[names[0]][i].Date.Format(TimeFormat))
+		for _, name := range names {
+			fmt.Printf("|$%-11v", balances[name][i].Amount.Format(digits[name]))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func printReconcile(account string, date time.Time, balance money.Amount, ms *MoneySense) error {
+	r, err := ms.Reconcile(account, date, balance)
+	if err != nil {
+		return err
+	}
+	digits := ms.accountDigits(account)
+	fmt.Printf("Statement $%v, history $%v, discrepancy $%v\n", r.Statement.Format(digits), r.Computed.Format(digits), r.Discrepancy().Format(digits))
+	if r.Discrepancy() == 0 {
+		fmt.Println("Reconciled.")
+		return nil
+	}
+	if len(r.Candidates) == 0 {
+		fmt.Println("No single transaction explains the discrepancy.")
+		return nil
+	}
+	fmt.Printf("|%-16s|%-12s|%-10s|%-24s|%-10s|%v\n", "ID", "Account", "Date", "Mechant", "Amount", "Reason")
+	fmt.Println("--------------------------------------------------------------------------------------------")
+	for _, c := range r.Candidates {
+		fmt.Printf("|%-16v|%-12v|%-10v|%-24v|%-10v|%v\n", c.ID, c.Account, c.Date.Format(TimeFormat), c.Mechant, c.Original.Format(money.Digits(c.Currency))+" "+c.Currency, c.Reason)
+	}
+	return nil
+}
+
+func printReconciliations(account string, ms *MoneySense) error {
+	reconciliations, err := ms.Reconciliations(account)
+	if err != nil {
+		return err
 	}
-	err := PlotPieByCategory(m)
+	digits := ms.accountDigits(account)
+	fmt.Printf("|%-10s|%-12s|%-12s|%-12s\n", "Date", "Statement", "History", "Discrepancy")
+	fmt.Println("----------------------------------------------------")
+	for _, r := range reconciliations {
+		fmt.Printf("|%-10v|$%-11v|$%-11v|$%-11v\n", r.Date.Format(TimeFormat), r.Statement.Format(digits), r.Computed.Format(digits), r.Discrepancy().Format(digits))
+	}
+	return nil
+}
+
+func printAccounts(ms *MoneySense) error {
+	accounts, err := ms.Accounts()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("|%-16s|%-10s|%-8s|%-20s|%-12s\n", "Name", "Type", "Currency", "Institution", "Transactions")
+	fmt.Println("------------------------------------------------------------------------")
+	for _, a := range accounts {
+		fmt.Printf("|%-16v|%-10v|%-8v|%-20v|%-12v\n", a.Name, a.Type, a.Currency, a.Institution, a.Transactions)
+	}
+	return nil
+}
+
+func printKinds(ms *MoneySense) error {
+	fmt.Printf("|%-16s|%-16s\n", "Category", "Kind")
+	fmt.Println("----------------------------------")
+	for _, k := range ms.Kinds() {
+		fmt.Printf("|%-16v|%-16v\n", k.Category, k.Kind)
+	}
+	return nil
+}
+
+// printEnvelope reports the balance of the envelope of a budget in every
+// period between start and end.
+func printEnvelope(category string, start string, end string, ms *MoneySense) error {
+	startDate, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", start)
+	}
+	endDate, err := time.Parse(TimeFormat, end)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", end)
+	}
+	budgets, err := ms.Budgets()
 	if err != nil {
 		return err
 	}
+	for _, b := range budgets {
+		if b.Category != category {
+			continue
+		}
+		periods, err := ms.Envelope(b, startDate, endDate)
+		if err != nil {
+			return err
+		}
+		d := ms.digits()
+		fmt.Printf("%v: $%v a %v, rollover %v\n", b.Category, b.Amount.Format(d), b.Period, b.Rollover)
+		fmt.Printf("|%-10s|%-10s|%-10s|%-10s|%-10s|%-10s\n", "Start", "Carried", "Budgeted", "Allocated", "Spent", "Balance")
+		fmt.Println("-------------------------------------------------------------------")
+		for _, p := range periods {
+			fmt.Printf("|%-10v|$%-9v|$%-9v|$%-9v|$%-9v|$%-9v\n",
+				p.Start.Format(TimeFormat), p.Carried.Format(d), p.Budgeted.Format(d), p.Allocated.Format(d), p.Spent.Format(d), p.Balance.Format(d))
+		}
+		return nil
+	}
+	return fmt.Errorf("No budget for %v", category)
+}
 
+// printAllocations lists the allocations between start and end against
+// the income they were made from.
+func printAllocations(start string, end string, ms *MoneySense) error {
+	startDate, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", start)
+	}
+	endDate, err := time.Parse(TimeFormat, end)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", end)
+	}
+	allocations, err := ms.Allocations("*", startDate, endDate)
+	if err != nil {
+		return err
+	}
+	income := ms.Income(startDate, endDate)
+
+	var allocated money.Amount
+	d := ms.digits()
+	fmt.Printf("|%-10s|%-16s|%-10s\n", "Date", "Category", "Amount")
+	fmt.Println("--------------------------------------")
+	for _, a := range allocations {
+		fmt.Printf("|%-10v|%-16v|$%-9v\n", a.Date.Format(TimeFormat), a.Category, a.Amount.Format(d))
+		allocated += a.Amount
+	}
+	fmt.Printf("Income $%v, allocated $%v, unallocated $%v\n", income.Format(d), allocated.Format(d), (income - allocated).Format(d))
+	return nil
+}
+
+func printOverrides(ms *MoneySense) error {
+	overrides, err := ms.Overrides()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("|%-16s|%-16s\n", "ID", "Category")
+	fmt.Println("----------------------------------")
+	for _, o := range overrides {
+		fmt.Printf("|%-16v|%-16v\n", o.ID, o.Category)
+	}
+	return nil
+}
+
+func printRules(ms *MoneySense) error {
+	rules, err := ms.loadRules()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("|%-8s|%-10s|%-24s|%-16s|%-10s|%-10s\n", "Priority", "Match", "Pattern", "Category", "Min", "Max")
+	fmt.Println("-----------------------------------------------------------------------------------")
+	for _, r := range rules {
+		min, max := "", ""
+		if r.Min.Valid {
+			min = strconv.FormatFloat(r.Min.Float64, 'f', 2, 64)
+		}
+		if r.Max.Valid {
+			max = strconv.FormatFloat(r.Max.Float64, 'f', 2, 64)
+		}
+		fmt.Printf("|%-8v|%-10v|%-24v|%-16v|%-10v|%-10v\n", r.Priority, r.Match, r.Pattern, r.Category, min, max)
+	}
+	return nil
+}
+
+func printNearDuplicates(days int, ms *MoneySense) {
+	dups := ms.NearDuplicates(days)
+	fmt.Printf("|%-16s|%-10s|%-16s|%-10s|%-24s|%-10s\n", "ID", "Date", "Other ID", "Date", "Mechant", "Amount")
+	fmt.Println("----------------------------------------------------------------------------------------------")
+	for _, d := range dups {
+		fmt.Printf("|%-16v|%-10v|%-16v|%-10v|%-24v|%-10v\n", d.ID, d.Date.Format(TimeFormat), d.OtherID, d.Other.Format(TimeFormat), d.Mechant, d.Amount.Text(money.MaxDigits))
+	}
+}
+
+// depthArg reads the optional category depth at args[i], zero when it is
+// not given.
+func depthArg(args []string, i int) (int, error) {
+	if len(args) <= i {
+		return 0, nil
+	}
+	depth, err := strconv.Atoi(args[i])
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("Bad category depth %q", args[i])
+	}
+	return depth, nil
+}
+
+// printCategoryPercentage reports the categories under root, rolled up to
+// depth levels, or not at all when depth is zero.
+func printCategoryPercentage(start string, end string, ms *MoneySense, depth int, root string) error {
+	var total money.Amount
+
+	var m = make(map[string]money.Amount)
+
+	if depth > 0 && root != "*" && depth < categoryDepth(root) {
+		depth = categoryDepth(root)
+	}
+	records := ms.Retrieve(root, start, end)
+	for _, r := range records {
+		m[categoryAtDepth(r.Category, depth)] += r.Amount
+	}
+	d := ms.digits()
 	pl := sortMapByValue(m)
-	fmt.Printf("|%-16s|%-16s|%-16s\n", "Category", "Percentage", "Amount")
-	fmt.Println("-----------------------------------------------")
 	for _, amount := range m {
 		total += amount
 	}
+	if out := reportOutput(); out != nil {
+		var rows [][]string
+		for _, p := range pl {
+			rows = append(rows, []string{p.Key, fmt.Sprintf("%.2f", percentOf(p.Value, total)), p.Value.Format(d)})
+		}
+		return writeReport(out, []string{"TEXT", "REAL", "REAL"}, []string{"category", "percentage", "amount"}, rows)
+	}
+
+	data := make(map[string]float64)
+	for category, amount := range m {
+		data[category] = amount.Float(d)
+	}
+	err := PlotPieByCategory(data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("|%-16s|%-16s|%-16s\n", "Category", "Percentage", "Amount")
+	fmt.Println("-----------------------------------------------")
 	for _, p := range pl {
-		fmt.Printf("|%-16v|%%%-15.2f|$%-16.2f\n", p.Key, (p.Value/total)*100, p.Value)
+		fmt.Printf("|%-16v|%%%-15.2f|$%-16v\n", p.Key, percentOf(p.Value, total), p.Value.Format(d))
 	}
 	return nil
 }
 
-func printHistory(category string, start string, end string, ms *MoneySense, unit TimeUnit) error {
+// printCategoryTree reports the category tree under root with the amounts
+// of children rolled up into their parents.
+func printCategoryTree(start string, end string, ms *MoneySense, root string) error {
+	var m = make(map[string]money.Amount)
+
+	records := ms.Retrieve(root, start, end)
+	for _, r := range records {
+		m[r.Category] += r.Amount
+	}
+	tree := buildCategoryTree(m)
+	node := tree.find(root)
+	if node == nil {
+		return fmt.Errorf("No category %v", root)
+	}
+
+	fmt.Printf("|%-32s|%-16s|%-16s\n", "Category", "Percentage", "Amount")
+	fmt.Println("---------------------------------------------------------------")
+	d := ms.digits()
+	if node == tree {
+		node.print(0, node.Total, d)
+		return nil
+	}
+	fmt.Printf("|%-32s|%%%-15.2f|$%-16v\n", node.Path, 100.0, node.Total.Format(d))
+	node.print(1, node.Total, d)
+	return nil
+}
+
+// printHistory plots the history of the categories under category, rolled
+// up to depth levels, or not at all when depth is zero.
+func printHistory(category string, start string, end string, ms *MoneySense, unit TimeUnit, depth int) error {
 	var m = make(map[string][]Record)
 	records := ms.Retrieve(category, start, end)
+	if len(records) == 0 {
+		return fmt.Errorf("No records of %v between %v and %v", category, start, end)
+	}
 	for _, r := range records {
-		m[r.Category] = append(m[r.Category], r)
+		key := categoryAtDepth(r.Category, depth)
+		r.Category = key
+		m[key] = append(m[key], r)
 	}
 
 	switch unit {
@@ -125,10 +1162,13 @@ func printHistory(category string, start string, end string, ms *MoneySense, uni
 			m[category] = mergeRecordsByMonth(rs)
 		}
 	}
-	fmt.Println("Plotting linepoints!")
-	err := plotLinePointsHistory(m)
-	if err != nil {
-		log.Fatal("Failed to plot line points for history!", err)
+	out := reportOutput()
+	if out == nil {
+		fmt.Println("Plotting linepoints!")
+		err := plotLinePointsHistory(m, ms.digits())
+		if err != nil {
+			return fmt.Errorf("Failed to plot line points for history: %v", err)
+		}
 	}
 
 	startDate := records[0].Date
@@ -136,12 +1176,27 @@ func printHistory(category string, start string, end string, ms *MoneySense, uni
 	for category, rs := range m {
 		m[category] = fillInRecords(category, rs, unit, startDate, endDate)
 	}
-	fmt.Println("Plotting barchart!")
-	err = plotBarChartHistory(m)
-	if err != nil {
-		log.Fatal("Failed to plot bar chart for history!", err)
+	if out == nil {
+		fmt.Println("Plotting barchart!")
+		err := plotBarChartHistory(m, ms.digits())
+		if err != nil {
+			return fmt.Errorf("Failed to plot bar chart for history: %v", err)
+		}
+		return nil
 	}
-	return nil
+
+	var categories []string
+	for category := range m {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var rows [][]string
+	for _, category := range categories {
+		for _, r := range m[category] {
+			rows = append(rows, []string{category, r.Date.Format(TimeFormat), r.Amount.Format(ms.digits())})
+		}
+	}
+	return writeReport(out, []string{"TEXT", "TIMESTAMP", "REAL"}, []string{"category", "date", "amount"}, rows)
 }
 
 func mergeRecordsByWeek(records []Record) []Record {
@@ -220,11 +1275,9 @@ func fillInRecords(category string, records []Record, unit TimeUnit, start time.
 			Days:  0,
 		}
 	}
-	fmt.Printf("start=%v, end=%v\n", start, end)
-	fmt.Printf("%v: sd=%v, ed=%v\n", category, sd, ed)
 	var r Record
 	var found bool
-	for t := sd; t.Before(ed); t = t.AddDate(step.Year, step.Month, step.Days) {
+	for t := sd; !t.After(ed); t = t.AddDate(step.Year, step.Month, step.Days) {
 		found = false
 		for _, record := range records {
 			if t.Equal(record.Date) {
@@ -240,7 +1293,6 @@ func fillInRecords(category string, records []Record, unit TimeUnit, start time.
 				Category: category,
 			}
 		}
-		fmt.Printf("t=%v\n", t)
 		result = append(result, r)
 	}
 	return result
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"./test_util"
+)
+
+func TestRunScript(t *testing.T) {
+	defer func() { reportFormat = FormatTable }()
+	cases := []struct {
+		script   string
+		format   string
+		expected string
+	}{
+		// Blank lines and comments are skipped, exit stops the script.
+		{"# reports for the spreadsheet\n\nformat csv\nexit\nformat bogus\n", FormatCSV, ""},
+		// The first failing command stops it, with its line.
+		{"format json\n  \nformat bogus\nformat csv\n", FormatJSON, `:3: Unknown format "bogus"`},
+		{"@savings\n", FormatTable, ":1: Require a command."},
+	}
+	for _, c := range cases {
+		reportFormat = FormatTable
+		fp := test_util.OpenCSVFromString(c.script, "script")
+		fp.Close()
+		err := runScript(fp.Name(), &MoneySense{})
+		os.Remove(fp.Name())
+		if c.expected == "" && err != nil {
+			t.Errorf("%q: unexpected %v", c.script, err)
+		}
+		if c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)) {
+			t.Errorf("%q: expected an error with %q, got %v", c.script, c.expected, err)
+		}
+		if reportFormat != c.format {
+			t.Errorf("%q: expected format %v, got %v", c.script, c.format, reportFormat)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range []string{FormatTable, FormatJSON, FormatCSV} {
+		if f, err := parseFormat(format); err != nil || f != format {
+			t.Errorf("parseFormat(%q) = %q, %v", format, f, err)
+		}
+	}
+	for _, format := range []string{"", "JSON", "xml"} {
+		if _, err := parseFormat(format); err == nil {
+			t.Errorf("Expected parseFormat(%q) to fail", format)
+		}
+	}
+}
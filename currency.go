@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"./money"
+)
+
+// CurrencyColumn is the history column holding the currency of a row, the
+// rows without one are in the currency of their account.
+const CurrencyColumn = "currency"
+
+// rateColumns are the columns of the exchange rate csv file: on date one
+// unit of the first currency of pair, such as EURUSD or EUR/USD, is worth
+// rate units of the second.
+var rateColumns = []string{"date", "pair", "rate"}
+var rateTypes = []string{"TIMESTAMP", "TEXT", "REAL"}
+
+// errNoRate is returned for a transaction whose currency can not be
+// converted into the base currency, it is left out of the reports.
+var errNoRate = errors.New("No exchange rate")
+
+type rate struct {
+	date time.Time
+	rate float64
+}
+
+// rateTable holds the exchange rates by pair, oldest first.
+type rateTable map[string][]rate
+
+func normalizePair(pair string) string {
+	pair = strings.ToUpper(pair)
+	for _, sep := range []string{"/", "-", " "} {
+		pair = strings.Replace(pair, sep, "", -1)
+	}
+	return pair
+}
+
+func (ms *MoneySense) loadRates() rateTable {
+	rates := make(rateTable)
+	if ms.rates == "" {
+		return rates
+	}
+
+	rows, err := ms.store.Query(fmt.Sprintf(`SELECT date, pair, rate FROM "%v"`, ms.rates))
+	if err != nil {
+		log.Fatal("Failed to query exchange rates: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pair string
+		var r rate
+		err = rows.Scan(&r.date, &pair, &r.rate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pair = normalizePair(pair)
+		rates[pair] = append(rates[pair], r)
+	}
+	for _, rs := range rates {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].date.Before(rs[j].date) })
+	}
+	return rates
+}
+
+// find returns the rate of pair on date: the last one known by then, or
+// the first one known if date is older than all of them.
+func (t rateTable) find(pair string, date time.Time) (float64, bool) {
+	rs := t[pair]
+	if len(rs) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].date.After(date) })
+	if i == 0 {
+		return rs[0].rate, true
+	}
+	return rs[i-1].rate, true
+}
+
+// convert returns the rate turning amounts in from into amounts in to on
+// date, going through the inverse pair when only that one is known.
+func (t rateTable) convert(from string, to string, date time.Time) (float64, error) {
+	if from == to || from == "" || to == "" {
+		return 1, nil
+	}
+	if r, ok := t.find(from+to, date); ok {
+		return r, nil
+	}
+	if r, ok := t.find(to+from, date); ok && r != 0 {
+		return 1 / r, nil
+	}
+	return 0, fmt.Errorf("No exchange rate from %v to %v", from, to)
+}
+
+// setOriginal sets the currency of t and its amount in it from amount,
+// the history column in minor units of money.MaxDigits digits of that
+// currency: the one of the row, else the one of its account, else the
+// base currency.
+func (ms *MoneySense) setOriginal(t *Transaction, amount money.Amount, currencies map[string]string) {
+	if t.Currency == "" {
+		t.Currency = currencies[t.Account]
+	}
+	if t.Currency == "" {
+		t.Currency = ms.base
+	}
+	t.Currency = strings.ToUpper(t.Currency)
+	t.Original = amount.Rescale(money.MaxDigits, money.Digits(t.Currency))
+}
+
+// convert sets Amount from the Original amount of t, at the rate of its
+// currency into the base currency on its date.
+func (ms *MoneySense) convert(t *Transaction, rates rateTable) error {
+	rate, err := rates.convert(t.Currency, ms.base, t.Date)
+	if err != nil {
+		return err
+	}
+	t.Amount = t.Original.Convert(rate, money.Digits(t.Currency), ms.digits())
+	return nil
+}
+
+// setAmount sets the amounts of t from amount, the history column, and
+// returns errNoRate, reporting it once for every currency, when it can not
+// be converted into the base currency.
+func (ms *MoneySense) setAmount(t *Transaction, amount money.Amount, rates rateTable, currencies map[string]string) error {
+	ms.setOriginal(t, amount, currencies)
+	err := ms.convert(t, rates)
+	if err != nil {
+		if ms.missingRates == nil {
+			ms.missingRates = make(map[string]bool)
+		}
+		if !ms.missingRates[t.Currency] {
+			ms.missingRates[t.Currency] = true
+			log.Printf("%v, leaving out the transactions in %v such as %v on %v\n", err, t.Currency, t.Mechant, t.Date.Format(TimeFormat))
+		}
+		return errNoRate
+	}
+	return nil
+}
+
+// warnMixedCurrencies warns when the history holds transactions in more
+// than one currency and there is no base currency to convert them into,
+// as the reports would add them up as they are.
+func (ms *MoneySense) warnMixedCurrencies() error {
+	if ms.base != "" {
+		return nil
+	}
+	currencies := ms.accountCurrencies()
+	query := fmt.Sprintf(`SELECT DISTINCT IFNULL(%v, '%v'), UPPER(IFNULL(%v, '')) FROM "%v"`, AccountColumn, DefaultAccount, CurrencyColumn, ms.history)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	seen := make(map[string]bool)
+	var found []string
+	for rows.Next() {
+		var account, currency string
+		err = rows.Scan(&account, &currency)
+		if err != nil {
+			return err
+		}
+		if currency == "" {
+			currency = strings.ToUpper(currencies[account])
+		}
+		if currency == "" {
+			currency = "unspecified"
+		}
+		if !seen[currency] {
+			seen[currency] = true
+			found = append(found, currency)
+		}
+	}
+	if len(found) > 1 {
+		sort.Strings(found)
+		log.Printf("Transactions are in more than one currency (%v) and no -base converts them, totals add them up as they are\n", strings.Join(found, ", "))
+	}
+	return rows.Err()
+}
+
+// accountCurrencies maps the registered accounts to their currency.
+func (ms *MoneySense) accountCurrencies() map[string]string {
+	currencies := make(map[string]string)
+	accounts, err := ms.Accounts()
+	if err != nil {
+		log.Fatal("Failed to query accounts: ", err)
+	}
+	for _, a := range accounts {
+		currencies[a.Name] = a.Currency
+	}
+	return currencies
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizePair(t *testing.T) {
+	for _, pair := range []string{"EURUSD", "eur/usd", "EUR-USD", "EUR USD"} {
+		if normalizePair(pair) != "EURUSD" {
+			t.Errorf("normalizePair(%q) = %q, expected EURUSD", pair, normalizePair(pair))
+		}
+	}
+}
+
+func TestRateTableConvert(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2019, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	rates := rateTable{
+		"EURUSD": {{day(1, 1), 1.10}, {day(1, 25), 1.20}},
+		"USDJPY": {{day(1, 10), 110}},
+	}
+	cases := []struct {
+		from     string
+		to       string
+		date     time.Time
+		expected float64
+		ok       bool
+	}{
+		{"USD", "USD", day(1, 5), 1, true},
+		{"", "USD", day(1, 5), 1, true},
+		{"EUR", "", day(1, 5), 1, true},
+		{"EUR", "USD", day(1, 1), 1.10, true},
+		{"EUR", "USD", day(1, 24), 1.10, true},
+		{"EUR", "USD", day(1, 25), 1.20, true},
+		{"EUR", "USD", day(3, 1), 1.20, true},
+		// Dates older than all rates take the first one.
+		{"USD", "JPY", day(1, 1), 110, true},
+		{"JPY", "USD", day(1, 15), 1.0 / 110, true},
+		{"EUR", "JPY", day(1, 15), 0, false},
+		{"GBP", "USD", day(1, 15), 0, false},
+	}
+	for _, c := range cases {
+		rate, err := rates.convert(c.from, c.to, c.date)
+		if (err == nil) != c.ok || rate != c.expected {
+			t.Errorf("convert(%v, %v, %v) = %v, %v, expected %v", c.from, c.to, c.date.Format(TimeFormat), rate, err, c.expected)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"./input"
+	"./money"
+	"./storage"
+)
+
+const FingerprintColumn = "fingerprint"
+
+// dedupInput wraps an input and appends a fingerprint to every row, skipping
+// rows whose fingerprint is already stored in the table being loaded.
+type dedupInput struct {
+	input.Input
+	seen       map[string]bool
+	counts     map[string]int
+	dateCol    int
+	mechantCol int
+	creditCol  int
+	debitCol   int
+	refCol     int
+	accountCol int
+	Skipped    int
+}
+
+func newDedupInput(in input.Input, store *storage.Storage, tableName string) *dedupInput {
+	d := &dedupInput{
+		Input:  in,
+		seen:   make(map[string]bool),
+		counts: make(map[string]int),
+	}
+	d.dateCol = columnIndex(in.Columns(), "date")
+	d.mechantCol = columnIndex(in.Columns(), "mechant")
+	d.creditCol = columnIndex(in.Columns(), "credit")
+	d.debitCol = columnIndex(in.Columns(), "debit")
+	d.refCol = columnIndex(in.Columns(), "reference")
+	d.accountCol = columnIndex(in.Columns(), AccountColumn)
+
+	if !store.HasColumn(tableName, FingerprintColumn) {
+		return d
+	}
+	rows, err := store.Query(fmt.Sprintf(`SELECT %v FROM "%v" WHERE %v IS NOT NULL`, FingerprintColumn, tableName, FingerprintColumn))
+	if err != nil {
+		log.Fatal("Failed to read fingerprints:", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fp string
+		err = rows.Scan(&fp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d.seen[fp] = true
+	}
+	return d
+}
+
+func (d *dedupInput) Columns() []string {
+	return append(append([]string{}, d.Input.Columns()...), FingerprintColumn)
+}
+
+func (d *dedupInput) Types() []string {
+	return append(append([]string{}, d.Input.Types()...), "TEXT")
+}
+
+// ReadRow returns the next row that is not already stored, with its
+// fingerprint appended. Identical rows within one file are told apart by
+// their occurrence count, so two real purchases of the same amount on the
+// same day are both kept while the overlap of two exports is not.
+func (d *dedupInput) ReadRow() []string {
+	for {
+		row := d.Input.ReadRow()
+		if row == nil {
+			return nil
+		}
+		if len(row) == 0 {
+			continue
+		}
+		key := d.key(row)
+		d.counts[key]++
+		fp := fingerprint(key, d.counts[key])
+		if d.seen[fp] {
+			d.Skipped++
+			continue
+		}
+		d.seen[fp] = true
+		columnLen := len(d.Input.Columns())
+		if len(row) > columnLen {
+			row = row[:columnLen]
+		}
+		return append(row, fp)
+	}
+}
+
+// key normalizes the identifying fields of a row, so the same transaction
+// exported twice, possibly formatted differently, yields the same key. A
+// reference from the bank, such as an OFX FITID, identifies it on its own.
+// Rows of accounts other than the default one are only duplicates within
+// their account.
+func (d *dedupInput) key(row []string) string {
+	key := d.rowKey(row)
+	if account := field(row, d.accountCol); account != "" && account != DefaultAccount {
+		key = account + "|" + key
+	}
+	return key
+}
+
+func (d *dedupInput) rowKey(row []string) string {
+	if ref := field(row, d.refCol); ref != "" {
+		return "reference|" + ref
+	}
+	date := field(row, d.dateCol)
+	if t, err := time.Parse(d.TimeFormat(), date); err == nil {
+		date = t.Format("2006-01-02")
+	}
+	return strings.Join([]string{
+		date,
+		normalizeMechant(field(row, d.mechantCol)),
+		normalizeAmount(field(row, d.creditCol)),
+		normalizeAmount(field(row, d.debitCol)),
+	}, "|")
+}
+
+// normalizeMechant ignores the case and spacing of mechant, which exports
+// of the same statement do not always agree on.
+func normalizeMechant(mechant string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(mechant), " "))
+}
+
+func fingerprint(key string, occurrence int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%v|%d", key, occurrence)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// normalizeAmount parses amount as the import does, so "1,234.56" and
+// "1234.56" are the same, and writes it with two digits as fingerprints
+// always were.
+func normalizeAmount(amount string) string {
+	v, err := money.Parse(amount, '.', money.MaxDigits)
+	if err != nil {
+		return strings.TrimSpace(amount)
+	}
+	return v.Rescale(money.MaxDigits, 2).Format(2)
+}
+
+func columnIndex(columns []string, name string) int {
+	for i, c := range columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func field(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// NearDuplicate is a pair of transactions with the same mechant and amount
+// that were posted within a few days of each other. Mechants are the same
+// when they only differ in case and spacing, as for fingerprints.
+type NearDuplicate struct {
+	ID      string
+	Date    time.Time
+	OtherID string
+	Other   time.Time
+	Mechant string
+	// Amount is in the currency of the transactions, to money.MaxDigits
+	// digits.
+	Amount money.Amount
+}
+
+func (ms *MoneySense) NearDuplicates(days int) []NearDuplicate {
+	var result []NearDuplicate
+
+	query := fmt.Sprintf(`SELECT IFNULL(a.%[3]v, ''), a.date, IFNULL(b.%[3]v, ''), b.date, a.mechant, b.mechant, %[6]v
+		FROM "%[1]v" a INNER JOIN "%[1]v" b ON IFNULL(a.credit, 0) = IFNULL(b.credit, 0) AND IFNULL(a.debit, 0) = IFNULL(b.debit, 0)
+		AND IFNULL(a.%[5]v, '') = IFNULL(b.%[5]v, '') AND IFNULL(a.%[7]v, -1) = IFNULL(b.%[7]v, -1)
+		WHERE a.rowid < b.rowid AND abs(julianday(a.date) - julianday(b.date)) <= %[2]v AND %[4]v
+		AND NOT EXISTS (SELECT 1 FROM ms_dupok WHERE ms_dupok.a = a.%[3]v AND ms_dupok.b = b.%[3]v)
+		ORDER BY a.date ASC`, ms.history, days, FingerprintColumn, ms.accountCondition("a."), AccountColumn,
+		toMaxDigits("IFNULL(a.credit, 0) - IFNULL(a.debit, 0)", "a."), storage.DigitsColumn)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		log.Fatal("Failed to query near duplicates: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d NearDuplicate
+		var other string
+		err = rows.Scan(&d.ID, &d.Date, &d.OtherID, &d.Other, &d.Mechant, &other, &d.Amount)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if normalizeMechant(d.Mechant) == normalizeMechant(other) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// DropTransaction removes the history row with the given fingerprint.
+func (ms *MoneySense) DropTransaction(id string) error {
+	result, err := ms.store.Exec(fmt.Sprintf(`DELETE FROM "%v" WHERE %v = ?`, ms.history, FingerprintColumn), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("No transaction %v", id)
+	}
+	return nil
+}
+
+// KeepPair marks two transactions as reviewed and not duplicates, so they
+// are no longer listed by NearDuplicates.
+func (ms *MoneySense) KeepPair(id string, otherID string) error {
+	_, err := ms.store.Exec(`INSERT INTO ms_dupok(a, b) VALUES(?, ?), (?, ?)`, id, otherID, otherID, id)
+	ms.warnInMemory()
+	return err
+}
+
+// keptPairs returns the pairs KeepPair marked as not duplicates, keyed by
+// both IDs joined with "|" in either order.
+func (ms *MoneySense) keptPairs() map[string]bool {
+	kept := make(map[string]bool)
+	rows, err := ms.store.Query(`SELECT a, b FROM ms_dupok`)
+	if err != nil {
+		log.Fatal("Failed to query kept pairs: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		err = rows.Scan(&a, &b)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kept[a+"|"+b] = true
+	}
+	return kept
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeMechant(t *testing.T) {
+	cases := []struct {
+		mechant  string
+		expected string
+	}{
+		{"SAFEWAY STORE", "SAFEWAY STORE"},
+		{"Safeway  Store", "SAFEWAY STORE"},
+		{" safeway\tstore ", "SAFEWAY STORE"},
+		{"SAFEWAY #12", "SAFEWAY #12"},
+	}
+	for _, c := range cases {
+		if m := normalizeMechant(c.mechant); m != c.expected {
+			t.Errorf("normalizeMechant(%q) = %q, expected %q", c.mechant, m, c.expected)
+		}
+	}
+}
+
+func TestNormalizeAmount(t *testing.T) {
+	cases := []struct {
+		amount   string
+		expected string
+	}{
+		{"1234.56", "1234.56"},
+		{"1,234.56", "1234.56"},
+		{" 12 ", "12.00"},
+		{"$12.5", "12.50"},
+		{"", "0.00"},
+	}
+	for _, c := range cases {
+		if a := normalizeAmount(c.amount); a != c.expected {
+			t.Errorf("normalizeAmount(%q) = %q, expected %q", c.amount, a, c.expected)
+		}
+	}
+}
+
+// historyCount counts the rows of the history of ms.
+func historyCount(t *testing.T, ms *MoneySense) int {
+	var count int
+	err := ms.store.QueryRow(`SELECT COUNT(*) FROM "` + ms.history + `"`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestImportSkipsOverlap(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		// Two purchases of the same amount on the same day, both real.
+		"history/jan.csv": "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n01/03/2019,SAFEWAY,20.5\n01/03/2019,SAFEWAY,20.5\n01/10/2019,APPLE,\"1,234.56\"\n",
+		// The next export starts a week before the end of the last one.
+		"history/jan-feb.csv": "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n01/03/2019,Safeway,20.50\n01/03/2019,SAFEWAY,20.50\n01/10/2019,APPLE,1234.56\n02/01/2019,APPLE,5\n",
+	}, MoneySenseOptions{})
+	if count := historyCount(t, ms); count != 4 {
+		t.Errorf("Expected 4 transactions, got %v", count)
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		"history/jan.csv": "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n01/03/2019,SAFEWAY,20.5\n01/04/2019,Safeway ,20.5\n01/20/2019,SAFEWAY,20.5\n01/04/2019,ALDI,20.5\n",
+	}, MoneySenseOptions{})
+
+	dups := ms.NearDuplicates(3)
+	if len(dups) != 1 {
+		t.Fatalf("Expected 1 near duplicate, got %v", dups)
+	}
+	d := dups[0]
+	if d.Mechant != "SAFEWAY" || d.Amount != 205000 || d.Other.Sub(d.Date) != 24*time.Hour {
+		t.Errorf("Unexpected near duplicate %+v", d)
+	}
+
+	err := ms.KeepPair(d.ID, d.OtherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dups := ms.NearDuplicates(3); len(dups) != 0 {
+		t.Errorf("Expected the kept pair to be left out, got %v", dups)
+	}
+	if !ms.keptPairs()[d.OtherID+"|"+d.ID] {
+		t.Errorf("Expected the pair to be kept both ways")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"./money"
+	"./storage"
+)
+
+// Allocation puts part of the income into the envelope of a budget, on
+// top of the amount the budget gets every period.
+type Allocation struct {
+	Date     time.Time
+	Category string
+	Amount   money.Amount
+}
+
+// EnvelopePeriod is one period of a budget run as an envelope: what was
+// carried over from the period before, put in, and spent.
+type EnvelopePeriod struct {
+	Start     time.Time
+	End       time.Time
+	Carried   money.Amount
+	Budgeted  money.Amount
+	Allocated money.Amount
+	Spent     money.Amount
+	Balance   money.Amount
+}
+
+// Available is what could be spent in the period.
+func (p EnvelopePeriod) Available() money.Amount {
+	return p.Carried + p.Budgeted + p.Allocated
+}
+
+// carry returns what a balance left at the end of a period brings to the
+// next one under the rollover rule of b.
+func (b Budget) carry(balance money.Amount) money.Amount {
+	switch b.Rollover {
+	case RolloverCarry:
+		return balance
+	case RolloverCap:
+		if balance > b.Cap {
+			return b.Cap
+		}
+		return balance
+	}
+	return 0
+}
+
+// Envelope runs budget b as an envelope over the periods from the one
+// holding start to the one holding end, counting what is spent up to end.
+func (ms *MoneySense) Envelope(b Budget, start time.Time, end time.Time) ([]EnvelopePeriod, error) {
+	first, _, err := periodRange(b.Period, start)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(first) {
+		return nil, nil
+	}
+
+	records := ms.Retrieve(b.Category, first.Format(TimeFormat), end.Format(TimeFormat))
+	allocations, err := ms.Allocations(b.Category, first, end)
+	if err != nil {
+		return nil, err
+	}
+	return runEnvelope(b, first, end, records, allocations), nil
+}
+
+// runEnvelope runs budget b over the periods from the one starting on
+// first to the one holding end, with what records spent and allocations
+// put in.
+func runEnvelope(b Budget, first time.Time, end time.Time, records []Record, allocations []Allocation) []EnvelopePeriod {
+	var result []EnvelopePeriod
+
+	spent := make(map[string]money.Amount)
+	for _, r := range records {
+		// Bucket by the same boundaries as the periods below, weeks
+		// starting on Sunday.
+		pStart, _, _ := periodRange(b.Period, r.Date)
+		spent[pStart.Format(TimeFormat)] += r.Amount
+	}
+
+	var carried money.Amount
+	for pStart := first; !pStart.After(end); {
+		_, pEnd, _ := periodRange(b.Period, pStart)
+		p := EnvelopePeriod{
+			Start:    pStart,
+			End:      pEnd,
+			Carried:  carried,
+			Budgeted: b.Amount,
+			Spent:    spent[pStart.Format(TimeFormat)],
+		}
+		for _, a := range allocations {
+			if !a.Date.Before(pStart) && !a.Date.After(pEnd) {
+				p.Allocated += a.Amount
+			}
+		}
+		p.Balance = p.Available() - p.Spent
+		result = append(result, p)
+		carried = b.carry(p.Balance)
+		pStart = pEnd.AddDate(0, 0, 1)
+	}
+	return result
+}
+
+// firstDate returns the date of the oldest transaction of the history, or
+// def if there is none.
+func (ms *MoneySense) firstDate(def time.Time) time.Time {
+	var first time.Time
+	query := fmt.Sprintf(`SELECT date FROM "%v" ORDER BY date ASC LIMIT 1`, ms.history)
+	err := ms.store.QueryRow(query).Scan(&first)
+	if err != nil {
+		return def
+	}
+	return first
+}
+
+// Allocations lists the allocations to category between start and end,
+// or to every category if it is "*".
+func (ms *MoneySense) Allocations(category string, start time.Time, end time.Time) ([]Allocation, error) {
+	var result []Allocation
+
+	query := fmt.Sprintf(`SELECT date, category, %v FROM ms_allocations WHERE date >= ? AND date <= ? ORDER BY date ASC`, toMaxDigits("amount", ""))
+	rows, err := ms.store.Query(query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Allocation
+		err = rows.Scan(&a.Date, &a.Category, &a.Amount)
+		if err != nil {
+			return nil, err
+		}
+		a.Amount = a.Amount.Rescale(money.MaxDigits, ms.digits())
+		if category == "*" || a.Category == category {
+			result = append(result, a)
+		}
+	}
+	return result, rows.Err()
+}
+
+// Allocate puts amount of the income into the envelope of category on
+// date. A negative amount takes money back out.
+func (ms *MoneySense) Allocate(a Allocation) error {
+	budgets, err := ms.Budgets()
+	if err != nil {
+		return err
+	}
+	for _, b := range budgets {
+		if b.Category == a.Category {
+			query := fmt.Sprintf(`INSERT INTO ms_allocations(date, category, amount, %v) VALUES(?, ?, ?, ?)`, storage.DigitsColumn)
+			_, err = ms.store.Exec(query, a.Date, a.Category, a.Amount, ms.digits())
+			ms.warnInMemory()
+			return err
+		}
+	}
+	return fmt.Errorf("No budget for %v", a.Category)
+}
+
+// Income sums the money that came in between start and end.
+func (ms *MoneySense) Income(start time.Time, end time.Time) money.Amount {
+	var income money.Amount
+	for _, r := range ms.Flows(start.Format(TimeFormat), end.Format(TimeFormat)) {
+		if r.Kind == KindIncome {
+			income -= r.Amount
+		}
+	}
+	return income
+}
+
+// parseAllocation reads the "<date> <category> <amount>" arguments of the
+// allocate command, the amount in minor units of digits digits.
+func parseAllocation(args []string, digits int) (Allocation, error) {
+	if len(args) != 3 {
+		return Allocation{}, errors.New("Require date, category and amount.")
+	}
+	date, err := time.Parse(TimeFormat, args[0])
+	if err != nil {
+		return Allocation{}, fmt.Errorf("Failed to parse date: %v", args[0])
+	}
+	amount, err := money.Parse(args[2], '.', digits)
+	if err != nil {
+		return Allocation{}, fmt.Errorf("Bad amount %q", args[2])
+	}
+	return Allocation{Date: date, Category: args[1], Amount: amount}, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestBudgetCarry(t *testing.T) {
+	cases := []struct {
+		rollover string
+		cap      money.Amount
+		balance  money.Amount
+		expected money.Amount
+	}{
+		{RolloverReset, 0, 5000, 0},
+		{RolloverReset, 0, -5000, 0},
+		{RolloverCarry, 0, 5000, 5000},
+		{RolloverCarry, 0, -5000, -5000},
+		{RolloverCap, 3000, 5000, 3000},
+		{RolloverCap, 3000, 2000, 2000},
+		{RolloverCap, 3000, -5000, -5000},
+	}
+	for _, c := range cases {
+		b := Budget{Rollover: c.rollover, Cap: c.cap}
+		if carried := b.carry(c.balance); carried != c.expected {
+			t.Errorf("%v with cap %v carries %v of %v, expected %v", c.rollover, c.cap, carried, c.balance, c.expected)
+		}
+	}
+}
+
+func TestRunEnvelope(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2020, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	// 2020-03-01 and 2020-03-08 are Sundays, spending on them belongs to
+	// the week they start.
+	records := []Record{
+		{Date: day(2, 29), Amount: 1000},
+		{Date: day(3, 1), Amount: 2000},
+		{Date: day(3, 7), Amount: 500},
+		{Date: day(3, 8), Amount: 7000},
+	}
+	allocations := []Allocation{{Date: day(3, 14), Category: "fuel", Amount: 1500}}
+	cases := []struct {
+		rollover string
+		cap      money.Amount
+		expected []EnvelopePeriod
+	}{
+		{RolloverReset, 0, []EnvelopePeriod{
+			{Start: day(2, 23), End: day(2, 29), Budgeted: 5000, Spent: 1000, Balance: 4000},
+			{Start: day(3, 1), End: day(3, 7), Budgeted: 5000, Spent: 2500, Balance: 2500},
+			{Start: day(3, 8), End: day(3, 14), Budgeted: 5000, Allocated: 1500, Spent: 7000, Balance: -500},
+			{Start: day(3, 15), End: day(3, 21), Budgeted: 5000, Balance: 5000},
+		}},
+		{RolloverCarry, 0, []EnvelopePeriod{
+			{Start: day(2, 23), End: day(2, 29), Budgeted: 5000, Spent: 1000, Balance: 4000},
+			{Start: day(3, 1), End: day(3, 7), Carried: 4000, Budgeted: 5000, Spent: 2500, Balance: 6500},
+			{Start: day(3, 8), End: day(3, 14), Carried: 6500, Budgeted: 5000, Allocated: 1500, Spent: 7000, Balance: 6000},
+			{Start: day(3, 15), End: day(3, 21), Carried: 6000, Budgeted: 5000, Balance: 11000},
+		}},
+		{RolloverCap, 3000, []EnvelopePeriod{
+			{Start: day(2, 23), End: day(2, 29), Budgeted: 5000, Spent: 1000, Balance: 4000},
+			{Start: day(3, 1), End: day(3, 7), Carried: 3000, Budgeted: 5000, Spent: 2500, Balance: 5500},
+			{Start: day(3, 8), End: day(3, 14), Carried: 3000, Budgeted: 5000, Allocated: 1500, Spent: 7000, Balance: 2500},
+			{Start: day(3, 15), End: day(3, 21), Carried: 2500, Budgeted: 5000, Balance: 7500},
+		}},
+	}
+	for _, c := range cases {
+		b := Budget{Category: "fuel", Period: BudgetWeekly, Amount: 5000, Rollover: c.rollover, Cap: c.cap}
+		periods := runEnvelope(b, day(2, 23), day(3, 15), records, allocations)
+		if len(periods) != len(c.expected) {
+			t.Errorf("%v: expected %v periods, got %v", c.rollover, len(c.expected), len(periods))
+			continue
+		}
+		for i, p := range periods {
+			if p != c.expected[i] {
+				t.Errorf("%v: expected %+v, got %+v", c.rollover, c.expected[i], p)
+			}
+		}
+	}
+}
+
+func TestParseBudgetRollover(t *testing.T) {
+	b, err := parseBudget([]string{"fuel", "week", "50", "cap", "20"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Rollover != RolloverCap || b.Cap != 2000 {
+		t.Errorf("Unexpected budget %+v", b)
+	}
+	if _, err := parseBudget([]string{"fuel", "week", "50", "cap", "1.234"}, 2); err == nil {
+		t.Errorf("Expected a bad cap to fail")
+	}
+}
+
+func TestParseAllocation(t *testing.T) {
+	a, err := parseAllocation([]string{"03/01/2020", "fuel", "-12.5"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != (Allocation{Date: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), Category: "fuel", Amount: -1250}) {
+		t.Errorf("Unexpected allocation %+v", a)
+	}
+	for _, args := range [][]string{{"03/01/2020", "fuel"}, {"2020-03-01", "fuel", "5"}, {"03/01/2020", "fuel", "1.234"}} {
+		if _, err := parseAllocation(args, 2); err == nil {
+			t.Errorf("Expected parseAllocation(%v) to fail", args)
+		}
+	}
+}
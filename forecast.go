@@ -0,0 +1,219 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"./money"
+)
+
+// forecastMonths is how many complete months before the current one the
+// trailing average is taken over, and shown next to the forecast.
+const forecastMonths = 6
+
+// forecastBand is the number of standard deviations of the monthly
+// spending the confidence band spans on either side, about 80%.
+const forecastBand = 1.28
+
+// ForecastMonth is the spending of a category in one month: Actual is what
+// was spent, up to the forecast date in the current month, and Projected
+// what the whole month is expected to come to, between Low and High.
+// Months before the current one only have Actual.
+type ForecastMonth struct {
+	Start     time.Time
+	Actual    money.Amount
+	Projected money.Amount
+	Low       money.Amount
+	High      money.Amount
+	// Recurring is the part of Projected from known recurring charges.
+	Recurring money.Amount
+}
+
+// Forecast is the spending of a category by month, the Past complete
+// months before the one holding the forecast date first.
+type Forecast struct {
+	Category string
+	Months   []ForecastMonth
+	Past     int
+}
+
+// Current returns the month holding the forecast date.
+func (f Forecast) Current() ForecastMonth {
+	return f.Months[f.Past]
+}
+
+// monthStart returns the first day of the month holding date.
+func monthStart(date time.Time) time.Time {
+	start, _, _ := periodRange(BudgetMonthly, date)
+	return start
+}
+
+// meanAndDeviation returns the mean and the standard deviation of values.
+func meanAndDeviation(values []money.Amount) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (float64(v) - mean) * (float64(v) - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// projectMonth returns what a month comes to when expected is still to be
+// spent on top of base, what was spent or is known to come, and the low
+// and high ends of the band around it, which never goes below base.
+func projectMonth(base money.Amount, expected float64, band float64) (money.Amount, money.Amount, money.Amount) {
+	projected := base + money.Amount(math.Round(expected))
+	low := projected - money.Amount(math.Round(band))
+	if low < base {
+		low = base
+	}
+	return projected, low, projected + money.Amount(math.Round(band))
+}
+
+// Forecast projects the expenses of every category, rolled up to depth
+// levels, for the rest of the month holding date and the months next
+// months. Each month is expected to take the average of the same month of
+// earlier years, or else of the last complete months, on top of the known
+// recurring charges, which are averaged without.
+func (ms *MoneySense) Forecast(date time.Time, months int, depth int) ([]Forecast, error) {
+	var result []Forecast
+
+	current := monthStart(date)
+	first := monthStart(ms.firstDate(date))
+	_, currentEnd, _ := periodRange(BudgetMonthly, date)
+	days := currentEnd.Sub(current).Hours()/24 + 1
+	elapsed := date.Sub(current).Hours()/24 + 1
+
+	// Spending by category and month, and the part of it that recurs.
+	spent := make(map[string]map[time.Time]money.Amount)
+	recurred := make(map[string]map[time.Time]money.Amount)
+	add := func(m map[string]map[time.Time]money.Amount, category string, month time.Time, amount money.Amount) {
+		if m[category] == nil {
+			m[category] = make(map[time.Time]money.Amount)
+		}
+		m[category][month] += amount
+	}
+	for _, r := range ms.Retrieve("*", first.Format(TimeFormat), date.Format(TimeFormat)) {
+		add(spent, categoryAtDepth(r.Category, depth), monthStart(r.Date), r.Amount)
+	}
+
+	subs, err := ms.Subscriptions(date)
+	if err != nil {
+		return nil, err
+	}
+	recurring := make(map[string]Subscription)
+	for _, s := range subs {
+		// A missed charge may well mean it was cancelled.
+		if !s.Missed {
+			recurring[s.Mechant] = s
+		}
+	}
+	transactions, err := ms.Transactions(first.Format(TimeFormat), date.Format(TimeFormat), "")
+	if err != nil {
+		return nil, err
+	}
+	transfers := ms.transferIDs()
+	for _, t := range transactions {
+		if _, ok := recurring[recurringKey(t.Mechant)]; ok && t.Amount > 0 && !transfers[t.ID] {
+			add(recurred, categoryAtDepth(t.Category, depth), monthStart(t.Date), t.Amount)
+		}
+	}
+
+	// The recurring charges still to come by month.
+	last := current.AddDate(0, months+1, -1)
+	upcoming := make(map[string]map[time.Time]money.Amount)
+	for _, s := range recurring {
+		for next := s.Next; !next.After(last); next = s.cadence.next(next) {
+			if next.After(date) {
+				add(upcoming, categoryAtDepth(s.Category, depth), monthStart(next), s.Amount)
+			}
+		}
+	}
+
+	categories := make(map[string]bool)
+	for category := range spent {
+		categories[category] = true
+	}
+	for category := range upcoming {
+		categories[category] = true
+	}
+	for category := range categories {
+		f := Forecast{Category: category}
+
+		// What was spent besides the recurring charges in the complete
+		// months since the category was first spent on, and in the
+		// trailing ones.
+		since := current
+		for month := first; month.Before(since); month = month.AddDate(0, 1, 0) {
+			if spent[category][month] != 0 {
+				since = month
+			}
+		}
+		var trailing []money.Amount
+		history := make(map[time.Time]money.Amount)
+		for month := first; month.Before(current); month = month.AddDate(0, 1, 0) {
+			rest := spent[category][month] - recurred[category][month]
+			if rest < 0 {
+				rest = 0
+			}
+			history[month] = rest
+			if !month.Before(current.AddDate(0, -forecastMonths, 0)) {
+				f.Months = append(f.Months, ForecastMonth{Start: month, Actual: spent[category][month]})
+				if !month.Before(since) {
+					trailing = append(trailing, rest)
+				}
+			}
+		}
+		f.Past = len(f.Months)
+		mean, deviation := meanAndDeviation(trailing)
+		if len(trailing) == 0 {
+			// Without a complete month go by the pace of this one.
+			rest := spent[category][current] - recurred[category][current]
+			mean = float64(rest) * days / elapsed
+		}
+
+		for i := 0; i <= months; i++ {
+			month := current.AddDate(0, i, 0)
+			// Seasons only count once the category has a year of
+			// history.
+			var same []money.Amount
+			for y := month.AddDate(-1, 0, 0); !y.Before(since); y = y.AddDate(-1, 0, 0) {
+				same = append(same, history[y])
+			}
+			expected := mean
+			if len(same) > 0 {
+				expected, _ = meanAndDeviation(same)
+			}
+			band := forecastBand * deviation
+
+			m := ForecastMonth{Start: month, Recurring: upcoming[category][month]}
+			if i == 0 {
+				// Only the rest of the current month is still to come.
+				left := (days - elapsed) / days
+				expected *= left
+				band *= left
+				m.Actual = spent[category][current]
+				m.Recurring += recurred[category][current]
+			}
+			m.Projected, m.Low, m.High = projectMonth(m.Actual+upcoming[category][month], expected, band)
+			f.Months = append(f.Months, m)
+		}
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Current().Projected, result[j].Current().Projected
+		if a != b {
+			return a > b
+		}
+		return result[i].Category < result[j].Category
+	})
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestMeanAndDeviation(t *testing.T) {
+	cases := []struct {
+		values    []money.Amount
+		mean      float64
+		deviation float64
+	}{
+		{nil, 0, 0},
+		{[]money.Amount{1000}, 1000, 0},
+		{[]money.Amount{1000, 3000}, 2000, 1000},
+		{[]money.Amount{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+	for _, c := range cases {
+		mean, deviation := meanAndDeviation(c.values)
+		if mean != c.mean || math.Abs(deviation-c.deviation) > 1e-9 {
+			t.Errorf("meanAndDeviation(%v) = %v, %v, expected %v, %v", c.values, mean, deviation, c.mean, c.deviation)
+		}
+	}
+}
+
+func TestProjectMonth(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     money.Amount
+		expected float64
+		band     float64
+		low      money.Amount
+		proj     money.Amount
+		high     money.Amount
+	}{
+		{"no history", 0, 0, 0, 0, 0, 0},
+		{"steady", 0, 10000, 0, 10000, 10000, 10000},
+		{"band", 2000, 10000, 3000, 9000, 12000, 15000},
+		// The band never goes below what was spent already.
+		{"wide band", 2000, 1000, 5000, 2000, 3000, 8000},
+		{"rounding", 0, 100.5, 0.4, 101, 101, 101},
+	}
+	for _, c := range cases {
+		proj, low, high := projectMonth(c.base, c.expected, c.band)
+		if proj != c.proj || low != c.low || high != c.high {
+			t.Errorf("%v: expected %v < %v < %v, got %v < %v < %v", c.name, c.low, c.proj, c.high, low, proj, high)
+		}
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	date := time.Date(2020, 2, 29, 15, 0, 0, 0, time.UTC)
+	if start := monthStart(date); !start.Equal(time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("monthStart(%v) = %v", date, start)
+	}
+}
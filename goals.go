@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"./money"
+	"./storage"
+)
+
+// goalRateMonths is how many months back the saving rate of a goal is
+// taken over.
+const goalRateMonths = 3
+
+// Goal is an amount to save by a deadline. It is funded by an account,
+// whose balance is what was saved, or by a category, whose transactions
+// are the money put aside. Only what came in from Start on counts, all of
+// it when Start is zero.
+type Goal struct {
+	Name     string
+	Target   money.Amount
+	Deadline time.Time
+	Account  string
+	Category string
+	Start    time.Time
+}
+
+// GoalProgress is how a goal stands on a day.
+type GoalProgress struct {
+	Goal
+	Date  time.Time
+	Saved money.Amount
+	// Rate is what was saved a month on average over the last
+	// goalRateMonths months.
+	Rate money.Amount
+	// Required is what has to be saved every month left to reach the
+	// target by the deadline.
+	Required money.Amount
+	// Completion is when the target is reached at Rate, zero if never.
+	Completion time.Time
+	// History is what was saved at the end of every month up to Date.
+	History []Balance
+}
+
+// Remaining is what is left to save.
+func (p GoalProgress) Remaining() money.Amount {
+	if p.Saved >= p.Target {
+		return 0
+	}
+	return p.Target - p.Saved
+}
+
+// OnTrack tells whether the goal is reached by its deadline at the
+// current saving rate.
+func (p GoalProgress) OnTrack() bool {
+	return p.Remaining() == 0 || !p.Completion.IsZero() && !p.Completion.After(p.Deadline)
+}
+
+func (ms *MoneySense) Goals() ([]Goal, error) {
+	var result []Goal
+
+	query := fmt.Sprintf(`SELECT name, %v, deadline, IFNULL(account, ''), IFNULL(category, ''), start FROM ms_goals ORDER BY deadline ASC`, toMaxDigits("target", ""))
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g Goal
+		var start *time.Time
+		err = rows.Scan(&g.Name, &g.Target, &g.Deadline, &g.Account, &g.Category, &start)
+		if err != nil {
+			return nil, err
+		}
+		g.Target = g.Target.Rescale(money.MaxDigits, ms.goalDigits(g))
+		if start != nil {
+			g.Start = *start
+		}
+		result = append(result, g)
+	}
+	return result, rows.Err()
+}
+
+// goalDigits are the digits of the minor unit of the amounts of g, the
+// ones of the currency of its account or of the base currency.
+func (ms *MoneySense) goalDigits(g Goal) int {
+	if g.Account != "" {
+		return ms.accountDigits(g.Account)
+	}
+	return ms.digits()
+}
+
+// SetGoal replaces the goal named like g.
+func (ms *MoneySense) SetGoal(g Goal) error {
+	if g.Target <= 0 {
+		return errors.New("Goal targets should be positive.")
+	}
+	if (g.Account == "") == (g.Category == "") {
+		return errors.New("A goal is funded by either an account or a category.")
+	}
+	var start interface{}
+	if !g.Start.IsZero() {
+		start = g.Start
+	}
+	query := fmt.Sprintf(`INSERT OR REPLACE INTO ms_goals(name, target, deadline, account, category, start, %v) VALUES(?, ?, ?, ?, ?, ?, ?)`, storage.DigitsColumn)
+	_, err := ms.store.Exec(query, g.Name, g.Target, g.Deadline, g.Account, g.Category, start, ms.goalDigits(g))
+	ms.warnInMemory()
+	return err
+}
+
+func (ms *MoneySense) ClearGoal(name string) error {
+	result, err := ms.store.Exec(`DELETE FROM ms_goals WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("No goal %v", name)
+	}
+	return nil
+}
+
+// goalHistory returns what was saved for g at the end of every month from
+// its start to date, and on date.
+func (ms *MoneySense) goalHistory(g Goal, date time.Time) ([]Balance, error) {
+	var result []Balance
+
+	start := g.Start
+	if start.IsZero() {
+		start = ms.firstDate(date)
+	}
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Before(start) {
+		return nil, nil
+	}
+
+	var daily []Balance
+	if g.Account != "" {
+		balances, err := ms.Balances(g.Account, start.AddDate(0, 0, -1), date)
+		if err != nil {
+			return nil, err
+		}
+		// Before Start is what the account held already.
+		before := balances[0].Amount
+		if g.Start.IsZero() {
+			before = 0
+		}
+		for _, b := range balances[1:] {
+			daily = append(daily, Balance{Date: b.Date, Amount: b.Amount - before})
+		}
+	} else {
+		put := make(map[time.Time]money.Amount)
+		for _, r := range ms.Flows(start.Format(TimeFormat), date.Format(TimeFormat)) {
+			if r.Category != "" && inCategory(r.Category, g.Category) {
+				put[r.Date] += r.Amount
+			}
+		}
+		var saved money.Amount
+		for day := start; !day.After(date); day = day.AddDate(0, 0, 1) {
+			saved += put[day]
+			daily = append(daily, Balance{Date: day, Amount: saved})
+		}
+	}
+
+	for i, b := range daily {
+		if i == len(daily)-1 || b.Date.Month() != daily[i+1].Date.Month() {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+// GoalProgress reports every goal as of date.
+func (ms *MoneySense) GoalProgress(date time.Time) ([]GoalProgress, error) {
+	var result []GoalProgress
+
+	goals, err := ms.Goals()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range goals {
+		p := GoalProgress{Goal: g, Date: date}
+		p.History, err = ms.goalHistory(g, date)
+		if err != nil {
+			return nil, err
+		}
+		p.plan()
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// plan works out from the History of p what was saved, at what rate, and
+// what it takes to reach the target by the deadline.
+func (p *GoalProgress) plan() {
+	if len(p.History) > 0 {
+		p.Saved = p.History[len(p.History)-1].Amount
+	}
+
+	// The rate is taken from the end of the month goalRateMonths before
+	// the current one, or the start.
+	months := len(p.History) - 1
+	if months > goalRateMonths {
+		months = goalRateMonths
+	}
+	if months > 0 {
+		p.Rate = (p.Saved - p.History[len(p.History)-1-months].Amount).Mul(1 / float64(months))
+	}
+
+	remaining := p.Remaining()
+	left := monthsBetween(p.Date, p.Deadline)
+	if left < 1 {
+		left = 1
+	}
+	p.Required = remaining.Mul(1 / float64(left))
+	if remaining == 0 {
+		p.Completion = p.Date
+	} else if p.Rate > 0 {
+		n := int(math.Ceil(float64(remaining) / float64(p.Rate)))
+		p.Completion = p.Date.AddDate(0, n, 0)
+	}
+}
+
+// monthsBetween counts the month ends from start to end.
+func monthsBetween(start time.Time, end time.Time) int {
+	return (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month())
+}
+
+// parseGoal reads the "<name> <target> <deadline> [category] [start]"
+// arguments of the goal command, the goal being funded by account if it
+// is set and by the category otherwise.
+func parseGoal(args []string, account string, digits int) (Goal, error) {
+	if len(args) < 3 || len(args) > 5 {
+		return Goal{}, errors.New("Require name, target, deadline, @account or category, and optionally start date.")
+	}
+	target, err := money.Parse(args[1], '.', digits)
+	if err != nil {
+		return Goal{}, fmt.Errorf("Bad target %q", args[1])
+	}
+	deadline, err := time.Parse(TimeFormat, args[2])
+	if err != nil {
+		return Goal{}, fmt.Errorf("Failed to parse date: %v", args[2])
+	}
+	g := Goal{Name: args[0], Target: target, Deadline: deadline, Account: account}
+	rest := args[3:]
+	if account == "" && len(rest) > 0 {
+		g.Category = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 1 {
+		return Goal{}, errors.New("Too many arguments.")
+	}
+	if len(rest) == 1 {
+		g.Start, err = time.Parse(TimeFormat, rest[0])
+		if err != nil {
+			return Goal{}, fmt.Errorf("Failed to parse date: %v", rest[0])
+		}
+	}
+	return g, nil
+}
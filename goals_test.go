@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestGoalProgressPlan(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	history := func(amounts ...money.Amount) []Balance {
+		var result []Balance
+		for i, a := range amounts {
+			result = append(result, Balance{Date: day(2019, time.Month(i+1), 28), Amount: a})
+		}
+		return result
+	}
+	cases := []struct {
+		name       string
+		target     money.Amount
+		deadline   time.Time
+		history    []Balance
+		saved      money.Amount
+		rate       money.Amount
+		required   money.Amount
+		completion time.Time
+		onTrack    bool
+	}{
+		{"nothing saved", 120000, day(2019, 12, 31), nil, 0, 0, 24000, time.Time{}, false},
+		{"first month", 120000, day(2019, 12, 31), history(10000), 10000, 0, 22000, time.Time{}, false},
+		// 5 months to the deadline at 200.00 a month over the last 3.
+		{"on track", 200000, day(2019, 12, 31), history(10000, 30000, 50000, 70000, 90000, 110000, 130000), 130000, 20000, 14000, day(2019, 11, 28), true},
+		{"behind", 200000, day(2019, 9, 30), history(10000, 30000, 50000, 70000, 90000, 110000, 130000), 130000, 20000, 35000, day(2019, 11, 28), false},
+		{"spent from it", 200000, day(2019, 12, 31), history(50000, 40000, 30000), 30000, -10000, 34000, time.Time{}, false},
+		{"reached", 100000, day(2019, 12, 31), history(60000, 120000), 120000, 60000, 0, day(2019, 7, 28), true},
+		// Past the deadline the rest is required at once.
+		{"overdue", 200000, day(2019, 5, 31), history(10000, 30000, 50000, 70000, 90000, 110000, 130000), 130000, 20000, 70000, day(2019, 11, 28), false},
+	}
+	for _, c := range cases {
+		p := GoalProgress{Goal: Goal{Target: c.target, Deadline: c.deadline}, Date: day(2019, 7, 28), History: c.history}
+		p.plan()
+		if p.Saved != c.saved || p.Rate != c.rate || p.Required != c.required || !p.Completion.Equal(c.completion) || p.OnTrack() != c.onTrack {
+			t.Errorf("%v: got saved %v, rate %v, required %v, completion %v, on track %v", c.name, p.Saved, p.Rate, p.Required, p.Completion.Format(TimeFormat), p.OnTrack())
+		}
+	}
+}
+
+func TestParseGoal(t *testing.T) {
+	g, err := parseGoal([]string{"car", "5000", "12/31/2020", "savings/car", "01/01/2020"}, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Goal{Name: "car", Target: 500000, Deadline: time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), Category: "savings/car", Start: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if g != expected {
+		t.Errorf("Expected %+v, got %+v", expected, g)
+	}
+	g, err = parseGoal([]string{"trip", "800", "06/30/2020", "01/01/2020"}, "savings", 2)
+	if err != nil || g.Account != "savings" || g.Category != "" || g.Start.IsZero() {
+		t.Errorf("Unexpected %+v, %v", g, err)
+	}
+	for _, args := range [][]string{{"car", "5000"}, {"car", "5000", "2020-12-31"}, {"car", "5000", "12/31/2020", "car", "01/01/2020", "x"}} {
+		if _, err := parseGoal(args, "", 2); err == nil {
+			t.Errorf("Expected parseGoal(%v) to fail", args)
+		}
+	}
+}
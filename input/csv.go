@@ -119,3 +119,7 @@ func (csvInput *CSVInput) Columns() []string {
 func (csvInput *CSVInput) Types() []string {
 	return csvInput.types
 }
+
+func (csvInput *CSVInput) TimeFormat() string {
+	return csvInput.Options.TimeFormat
+}
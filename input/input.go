@@ -0,0 +1,21 @@
+package input
+
+// AmountType is the SQL type of money columns. Inputs hold them as
+// decimals, as in "20.50", and Storage loads them as an exact integer
+// number of minor units of money.MaxDigits digits, to be rescaled into the
+// minor units of their currency once that is known.
+const AmountType = "AMOUNT INTEGER"
+
+// Input is a source of typed rows that can be loaded into Storage.
+type Input interface {
+	// Name returns the name of the source being read.
+	Name() string
+	// Columns returns the column names of every row.
+	Columns() []string
+	// Types returns the SQL type of every column.
+	Types() []string
+	// ReadRow returns the next row, or nil at the end of the input.
+	ReadRow() []string
+	// TimeFormat is the layout TIMESTAMP values are written in.
+	TimeFormat() string
+}
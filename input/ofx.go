@@ -0,0 +1,132 @@
+package input
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"../money"
+)
+
+// OFXTimeFormat is the layout of the dates OFXInput returns.
+const OFXTimeFormat = "20060102"
+
+var ofxTag = regexp.MustCompile(`<(/?[A-Za-z0-9.]+)>([^<]*)`)
+
+// OFXInput reads the bank and credit card transactions of an OFX or QFX
+// statement, both the SGML (1.x) and XML (2.x) flavours, and returns rows
+// in the CanonicalColumns layout with the FITID as reference.
+type OFXInput struct {
+	name string
+	rows [][]string
+}
+
+func NewOFXInput(r io.Reader) (*OFXInput, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(strings.ToUpper(string(data)), "<OFX>") {
+		return nil, errors.New("Not an OFX statement")
+	}
+
+	ofxInput := &OFXInput{}
+	if asFile, ok := r.(*os.File); ok {
+		ofxInput.name = asFile.Name()
+	} else {
+		ofxInput.name = "pipe"
+	}
+
+	var txn map[string]string
+	for _, m := range ofxTag.FindAllStringSubmatch(string(data), -1) {
+		tag := strings.ToUpper(m[1])
+		value := strings.TrimSpace(m[2])
+		switch {
+		case tag == "STMTTRN":
+			txn = make(map[string]string)
+		case tag == "/STMTTRN":
+			if txn != nil {
+				ofxInput.addTransaction(txn)
+			}
+			txn = nil
+		case txn != nil && !strings.HasPrefix(tag, "/"):
+			if _, ok := txn[tag]; !ok {
+				txn[tag] = value
+			}
+		}
+	}
+	return ofxInput, nil
+}
+
+func (ofxInput *OFXInput) addTransaction(txn map[string]string) {
+	posted := txn["DTPOSTED"]
+	if len(posted) < 8 {
+		return
+	}
+
+	amountStr := txn["TRNAMT"]
+	decimal := '.'
+	if strings.Contains(amountStr, ",") && !strings.Contains(amountStr, ".") {
+		decimal = ','
+	}
+	amount, err := ParseAmount(amountStr, decimal)
+	if err != nil {
+		return
+	}
+	// OFX amounts are signed from the account's point of view, so money
+	// going out is negative.
+	var credit, debit money.Amount
+	if amount < 0 {
+		credit = -amount
+	} else {
+		debit = amount
+	}
+
+	mechant := ofxUnescape(txn["NAME"])
+	if mechant == "" {
+		mechant = ofxUnescape(txn["MEMO"])
+	}
+
+	ofxInput.rows = append(ofxInput.rows, []string{
+		posted[:8],
+		mechant,
+		formatAmount(credit),
+		formatAmount(debit),
+		txn["FITID"],
+	})
+}
+
+func ofxUnescape(s string) string {
+	r := strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'")
+	return strings.TrimSpace(r.Replace(s))
+}
+
+// ReadRow returns the next transaction of the statement, or nil when all
+// have been read.
+func (ofxInput *OFXInput) ReadRow() []string {
+	if len(ofxInput.rows) == 0 {
+		return nil
+	}
+	row := ofxInput.rows[0]
+	ofxInput.rows = ofxInput.rows[1:]
+	return row
+}
+
+func (ofxInput *OFXInput) Name() string {
+	return ofxInput.name
+}
+
+func (ofxInput *OFXInput) Columns() []string {
+	return CanonicalColumns
+}
+
+func (ofxInput *OFXInput) Types() []string {
+	return CanonicalTypes
+}
+
+func (ofxInput *OFXInput) TimeFormat() string {
+	return OFXTimeFormat
+}
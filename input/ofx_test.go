@@ -0,0 +1,80 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	sgmlOFX = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20190103120000[-8:PST]
+<TRNAMT>-20.50
+<FITID>2019010301
+<NAME>SAFEWAY &amp; CO
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20190104
+<TRNAMT>1000.00
+<FITID>2019010402
+<MEMO>PAYROLL
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+	xmlOFX = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20190105000000.000</DTPOSTED><TRNAMT>-999.00</TRNAMT><FITID>X1</FITID><NAME>APPLE</NAME></STMTTRN>
+</BANKTRANLIST></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+)
+
+func TestOFXInputReadsSGML(t *testing.T) {
+	input, err := NewOFXInput(strings.NewReader(sgmlOFX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"20190103", "SAFEWAY & CO", "20.5", "", "2019010301"},
+		{"20190104", "PAYROLL", "", "1000", "2019010402"},
+	}
+	for _, e := range expected {
+		row := input.ReadRow()
+		if !reflect.DeepEqual(row, e) {
+			t.Errorf("ReadRow() = %v, want %v", row, e)
+		}
+	}
+	if row := input.ReadRow(); row != nil {
+		t.Errorf("ReadRow() = %v, want nil", row)
+	}
+}
+
+func TestOFXInputReadsXML(t *testing.T) {
+	input, err := NewOFXInput(strings.NewReader(xmlOFX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"20190105", "APPLE", "999", "", "X1"}
+	if row := input.ReadRow(); !reflect.DeepEqual(row, expected) {
+		t.Errorf("ReadRow() = %v, want %v", row, expected)
+	}
+}
+
+func TestOFXInputRejectsOtherFiles(t *testing.T) {
+	_, err := NewOFXInput(strings.NewReader("TEXT,TEXT\nmechant,category\n"))
+	if err == nil {
+		t.Errorf("NewOFXInput accepted a csv file")
+	}
+}
@@ -0,0 +1,395 @@
+package input
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"../money"
+)
+
+// CanonicalColumns are the columns every bank export is mapped onto.
+var CanonicalColumns = []string{"date", "mechant", "credit", "debit", "reference"}
+
+// CanonicalTypes are the SQL types of CanonicalColumns.
+var CanonicalTypes = []string{"TIMESTAMP", "TEXT", AmountType, AmountType, "TEXT"}
+
+const (
+	// SignNegativeOut means money spent is negative in the amount column.
+	SignNegativeOut = "negative-out"
+	// SignPositiveOut means money spent is positive in the amount column.
+	SignPositiveOut = "positive-out"
+)
+
+// Profile describes how the raw CSV export of one bank maps onto the
+// canonical date/mechant/credit/debit schema. Credit is money going out of
+// the account and debit is money coming in.
+type Profile struct {
+	Name string
+	// Files is a glob matched against the base name of a file to select
+	// this profile for it.
+	Files string
+	// Header is the raw header line of the export, used to auto-detect
+	// this profile when no glob matches.
+	Header string
+
+	// Source column names for the canonical columns. Either Credit and
+	// Debit, or a single signed Amount column, must be set.
+	Date      string
+	Mechant   string
+	Credit    string
+	Debit     string
+	Amount    string
+	Reference string
+
+	DateFormat string
+	Separator  rune
+	// Decimal is the decimal separator of amounts, the other one of ',' and
+	// '.' is taken as the thousands separator.
+	Decimal rune
+	// Sign is SignNegativeOut or SignPositiveOut and applies to Amount.
+	Sign string
+	// SkipRows is the number of rows before the header line.
+	SkipRows int
+	// Account is the account the rows read with this profile belong to,
+	// if the file does not say otherwise.
+	Account string
+}
+
+var profileFields = []string{"name", "files", "header", "date", "mechant", "credit", "debit", "amount", "reference", "dateformat", "separator", "decimal", "sign", "skip", "account"}
+
+// LoadProfiles reads profiles from a CSV with one profile per row and a
+// header row naming the fields, e.g.
+// name,files,header,date,mechant,credit,debit,amount,reference,dateformat,separator,decimal,sign,skip,account
+func LoadProfiles(r io.Reader) ([]*Profile, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, f := range []string{"name", "date", "mechant"} {
+		if _, ok := index[f]; !ok {
+			return nil, fmt.Errorf("Profiles are missing the %q column", f)
+		}
+	}
+	for f := range index {
+		if !contains(profileFields, f) {
+			return nil, fmt.Errorf("Unknown profile column %q", f)
+		}
+	}
+
+	var profiles []*Profile
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			i, ok := index[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		p := &Profile{
+			Name:       get("name"),
+			Files:      get("files"),
+			Header:     get("header"),
+			Date:       get("date"),
+			Mechant:    get("mechant"),
+			Credit:     get("credit"),
+			Debit:      get("debit"),
+			Amount:     get("amount"),
+			Reference:  get("reference"),
+			DateFormat: get("dateformat"),
+			Separator:  parseSeparator(get("separator"), ','),
+			Decimal:    parseSeparator(get("decimal"), '.'),
+			Sign:       get("sign"),
+			Account:    get("account"),
+		}
+		if skip := get("skip"); skip != "" {
+			p.SkipRows, err = strconv.Atoi(skip)
+			if err != nil {
+				return nil, fmt.Errorf("Profile %v: bad skip %q", p.Name, skip)
+			}
+		}
+		if p.Sign == "" {
+			p.Sign = SignNegativeOut
+		}
+		err = p.validate()
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// LoadProfilesFile is LoadProfiles on the named file.
+func LoadProfilesFile(fileName string) ([]*Profile, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadProfiles(f)
+}
+
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return errors.New("Profile without a name")
+	}
+	if p.Date == "" || p.Mechant == "" {
+		return fmt.Errorf("Profile %v: date and mechant columns are required", p.Name)
+	}
+	if p.Amount == "" && p.Credit == "" && p.Debit == "" {
+		return fmt.Errorf("Profile %v: require an amount or credit/debit columns", p.Name)
+	}
+	if p.DateFormat == "" {
+		return fmt.Errorf("Profile %v: dateformat is required", p.Name)
+	}
+	if p.Sign != SignNegativeOut && p.Sign != SignPositiveOut {
+		return fmt.Errorf("Profile %v: unknown sign convention %q", p.Name, p.Sign)
+	}
+	return nil
+}
+
+// SelectProfile returns the profile for the file named fileName whose
+// first lines are head: the first profile whose Files glob matches the
+// base name, otherwise the first one whose Header matches the header line.
+// It returns nil when no profile applies.
+func SelectProfile(profiles []*Profile, fileName string, head []string) *Profile {
+	base := filepath.Base(fileName)
+	for _, p := range profiles {
+		if p.Files == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(p.Files, base); ok {
+			return p
+		}
+	}
+	for _, p := range profiles {
+		if p.Header == "" || p.SkipRows >= len(head) {
+			continue
+		}
+		if normalizeHeader(head[p.SkipRows]) == normalizeHeader(p.Header) {
+			return p
+		}
+	}
+	return nil
+}
+
+func normalizeHeader(line string) string {
+	line = strings.TrimPrefix(line, "\ufeff")
+	line = strings.Replace(line, `"`, "", -1)
+	return strings.ToLower(strings.TrimSpace(line))
+}
+
+// ProfileInput reads a raw bank export through a Profile and returns rows
+// in the CanonicalColumns layout.
+type ProfileInput struct {
+	Profile *Profile
+	reader  *csv.Reader
+	name    string
+	indexes map[string]int
+}
+
+func NewProfileInput(profile *Profile, r io.Reader) (*ProfileInput, error) {
+	profileInput := &ProfileInput{
+		Profile: profile,
+		reader:  csv.NewReader(r),
+		indexes: make(map[string]int),
+	}
+	profileInput.reader.FieldsPerRecord = -1
+	profileInput.reader.Comma = profile.Separator
+	profileInput.reader.LazyQuotes = true
+
+	for i := 0; i < profile.SkipRows; i++ {
+		_, err := profileInput.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+	}
+	header, err := profileInput.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range header {
+		profileInput.indexes[normalizeHeader(h)] = i
+	}
+	sources := map[string]string{
+		"date":      profile.Date,
+		"mechant":   profile.Mechant,
+		"credit":    profile.Credit,
+		"debit":     profile.Debit,
+		"amount":    profile.Amount,
+		"reference": profile.Reference,
+	}
+	for _, source := range sources {
+		if source == "" {
+			continue
+		}
+		if _, ok := profileInput.indexes[normalizeHeader(source)]; !ok {
+			return nil, fmt.Errorf("Profile %v: column %q not found in header", profile.Name, source)
+		}
+	}
+
+	if asFile, ok := r.(*os.File); ok {
+		profileInput.name = asFile.Name()
+	} else {
+		profileInput.name = "pipe"
+	}
+	return profileInput, nil
+}
+
+// ReadRow reads the next transaction of the export. Rows that can not be
+// parsed, such as the summary lines some banks end exports with, are
+// logged and returned empty, and nil is returned on EOF.
+func (profileInput *ProfileInput) ReadRow() []string {
+	record, err := profileInput.reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		log.Println(err)
+		return []string{}
+	}
+
+	p := profileInput.Profile
+	date := profileInput.get(record, p.Date)
+	if date == "" {
+		return []string{}
+	}
+	if _, err := time.Parse(p.DateFormat, date); err != nil {
+		log.Printf("%v: skipping %q: %v\n", profileInput.name, record, err)
+		return []string{}
+	}
+
+	var credit, debit money.Amount
+	if p.Amount != "" {
+		amount, err := ParseAmount(profileInput.get(record, p.Amount), p.Decimal)
+		if err != nil {
+			log.Printf("%v: skipping %q: %v\n", profileInput.name, record, err)
+			return []string{}
+		}
+		if p.Sign == SignNegativeOut {
+			amount = -amount
+		}
+		if amount >= 0 {
+			credit = amount
+		} else {
+			debit = -amount
+		}
+	} else {
+		var errCredit, errDebit error
+		credit, errCredit = ParseAmount(profileInput.get(record, p.Credit), p.Decimal)
+		debit, errDebit = ParseAmount(profileInput.get(record, p.Debit), p.Decimal)
+		if errCredit != nil || errDebit != nil {
+			err = errCredit
+			if err == nil {
+				err = errDebit
+			}
+			log.Printf("%v: skipping %q: %v\n", profileInput.name, record, err)
+			return []string{}
+		}
+		// A negative charge is money coming back and a negative payment
+		// money going out, move them to the other side.
+		if credit < 0 {
+			debit, credit = debit-credit, 0
+		}
+		if debit < 0 {
+			credit, debit = credit-debit, 0
+		}
+	}
+
+	return []string{
+		date,
+		profileInput.get(record, p.Mechant),
+		formatAmount(credit),
+		formatAmount(debit),
+		profileInput.get(record, p.Reference),
+	}
+}
+
+func (profileInput *ProfileInput) get(record []string, column string) string {
+	if column == "" {
+		return ""
+	}
+	i, ok := profileInput.indexes[normalizeHeader(column)]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (profileInput *ProfileInput) Name() string {
+	return profileInput.name
+}
+
+func (profileInput *ProfileInput) Columns() []string {
+	return CanonicalColumns
+}
+
+func (profileInput *ProfileInput) Types() []string {
+	return CanonicalTypes
+}
+
+func (profileInput *ProfileInput) TimeFormat() string {
+	return profileInput.Profile.DateFormat
+}
+
+// ParseAmount parses a bank formatted amount such as "1,234.56",
+// "1.234,56", "$12.00", "(12.00)" or "12.00-" using decimal as the decimal
+// separator. The currency is not known yet, so the amount keeps
+// money.MaxDigits digits. An empty amount is zero.
+func ParseAmount(s string, decimal rune) (money.Amount, error) {
+	return money.Parse(s, decimal, money.MaxDigits)
+}
+
+// formatAmount writes an amount of ParseAmount exactly, and zero as the
+// empty string.
+func formatAmount(a money.Amount) string {
+	return a.Text(money.MaxDigits)
+}
+
+func parseSeparator(s string, def rune) rune {
+	switch strings.ToLower(s) {
+	case "":
+		return def
+	case "tab", `\t`:
+		return '\t'
+	case "comma":
+		return ','
+	case "semicolon":
+		return ';'
+	case "dot":
+		return '.'
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package input
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"../test_util"
+)
+
+var (
+	profiles = `name,files,header,date,mechant,amount,credit,debit,reference,dateformat,separator,decimal,sign,skip,account
+signed,,"Buchungstag;Empfänger;Betrag;Referenz",Buchungstag,Empfänger,Betrag,,,Referenz,02.01.2006,;,",",negative-out,1,girokonto
+split,card-*.csv,,Posted,Payee,,Charge,Payment,,2006-01-02,,,,,
+`
+
+	signedExport = `Kontoauszug Girokonto
+Buchungstag;Empfänger;Betrag;Referenz
+03.01.2019;REWE;-1.234,50;A1
+04.01.2019;Gehalt;2.000,00;A2
+`
+
+	splitExport = `Posted,Payee,Charge,Payment
+2019-01-03,"SAFEWAY",$20.50,
+2019-01-04,PAYMENT,,"1,000.00"
+2019-01-05,REFUND,-5.00,
+2019-01-06,REVERSAL,,-7.25
+Total,,"1,020.50","1,000.00"
+`
+)
+
+func TestLoadProfiles(t *testing.T) {
+	ps, err := LoadProfiles(strings.NewReader(profiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("Expected 2 profiles, got (%v)", len(ps))
+	}
+	if ps[0].Separator != ';' || ps[0].Decimal != ',' || ps[0].SkipRows != 1 || ps[0].Account != "girokonto" {
+		t.Errorf("Unexpected profile %+v", ps[0])
+	}
+	if ps[1].Sign != SignNegativeOut || ps[1].Separator != ',' || ps[1].Decimal != '.' || ps[1].Account != "" {
+		t.Errorf("Unexpected defaults %+v", ps[1])
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	ps, _ := LoadProfiles(strings.NewReader(profiles))
+
+	if p := SelectProfile(ps, "/tmp/card-2019.csv", nil); p == nil || p.Name != "split" {
+		t.Errorf("SelectProfile by file name = %v, want split", p)
+	}
+	head := strings.Split(signedExport, "\n")
+	if p := SelectProfile(ps, "export.csv", head); p == nil || p.Name != "signed" {
+		t.Errorf("SelectProfile by header = %v, want signed", p)
+	}
+	if p := SelectProfile(ps, "history.csv", []string{"TIMESTAMP,TEXT,REAL"}); p != nil {
+		t.Errorf("SelectProfile = %v, want nil", p.Name)
+	}
+}
+
+func TestProfileInputSignedAmount(t *testing.T) {
+	ps, _ := LoadProfiles(strings.NewReader(profiles))
+	fp := test_util.OpenCSVFromString(signedExport, "signed.csv")
+	defer fp.Close()
+	defer os.Remove(fp.Name())
+
+	input, err := NewProfileInput(ps[0], fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"03.01.2019", "REWE", "1234.5", "", "A1"},
+		{"04.01.2019", "Gehalt", "", "2000", "A2"},
+	}
+	for _, e := range expected {
+		row := input.ReadRow()
+		if !reflect.DeepEqual(row, e) {
+			t.Errorf("ReadRow() = %v, want %v", row, e)
+		}
+	}
+	if row := input.ReadRow(); row != nil {
+		t.Errorf("ReadRow() = %v, want nil", row)
+	}
+}
+
+func TestProfileInputCreditDebit(t *testing.T) {
+	ps, _ := LoadProfiles(strings.NewReader(profiles))
+	fp := test_util.OpenCSVFromString(splitExport, "card.csv")
+	defer fp.Close()
+	defer os.Remove(fp.Name())
+
+	input, err := NewProfileInput(ps[1], fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input.Columns(), CanonicalColumns) {
+		t.Errorf("Columns() = %v, want %v", input.Columns(), CanonicalColumns)
+	}
+	expected := [][]string{
+		{"2019-01-03", "SAFEWAY", "20.5", "", ""},
+		{"2019-01-04", "PAYMENT", "", "1000", ""},
+		{"2019-01-05", "REFUND", "", "5", ""},
+		{"2019-01-06", "REVERSAL", "7.25", "", ""},
+		// The total line has no date and is skipped.
+		{},
+	}
+	for _, e := range expected {
+		row := input.ReadRow()
+		if !reflect.DeepEqual(row, e) {
+			t.Errorf("ReadRow() = %v, want %v", row, e)
+		}
+	}
+	if row := input.ReadRow(); row != nil {
+		t.Errorf("ReadRow() = %v, want nil", row)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in      string
+		decimal rune
+		want    string
+	}{
+		{"1,234.56", '.', "1234.56"},
+		{"1.234,56", ',', "1234.56"},
+		{"-12.00", '.', "-12"},
+		{"(12.00)", '.', "-12"},
+		{"12.00-", '.', "-12"},
+		{"$ 3.5", '.', "3.5"},
+		{"", '.', ""},
+	}
+	for _, c := range cases {
+		amount, err := ParseAmount(c.in, c.decimal)
+		if got := formatAmount(amount); err != nil || got != c.want {
+			t.Errorf("ParseAmount(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+}
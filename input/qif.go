@@ -0,0 +1,225 @@
+package input
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"../money"
+)
+
+// QIFTimeFormat is the layout of the dates QIFInput returns.
+const QIFTimeFormat = "2006-01-02"
+
+// QIFColumns are the columns of QIFInput rows, the canonical ones plus the
+// category and memo recorded in the QIF file.
+var QIFColumns = append(append([]string{}, CanonicalColumns...), "category", "memo")
+
+// QIFTypes are the SQL types of QIFColumns.
+var QIFTypes = append(append([]string{}, CanonicalTypes...), "TEXT", "TEXT")
+
+// QIFInput reads the transactions of the !Type:Bank and !Type:CCard blocks
+// of a QIF file, one row each. Transactions that can not be parsed are
+// logged and skipped.
+type QIFInput struct {
+	name   string
+	rows   [][]string
+	splits [][]QIFSplit
+	// last are the splits of the row ReadRow returned last.
+	last []QIFSplit
+}
+
+// QIFSplit is a split line of a QIF transaction. Amount is the money that
+// went out, negative if it came in, like the credit and debit of its row.
+type QIFSplit struct {
+	Category string
+	Memo     string
+	Amount   money.Amount
+}
+
+type qifSplit struct {
+	category string
+	memo     string
+	amount   string
+}
+
+type qifTransaction struct {
+	date     string
+	amount   string
+	payee    string
+	category string
+	memo     string
+	splits   []qifSplit
+}
+
+func NewQIFInput(r io.Reader) (*QIFInput, error) {
+	qifInput := &QIFInput{}
+	if asFile, ok := r.(*os.File); ok {
+		qifInput.name = asFile.Name()
+	} else {
+		qifInput.name = "pipe"
+	}
+
+	var inBlock bool
+	var txn qifTransaction
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line))
+			if strings.HasPrefix(header, "!type:") {
+				inBlock = header == "!type:bank" || header == "!type:ccard"
+			} else {
+				inBlock = false
+			}
+			txn = qifTransaction{}
+			continue
+		}
+		if !inBlock {
+			continue
+		}
+
+		value := strings.TrimSpace(line[1:])
+		switch line[0] {
+		case 'D':
+			txn.date = value
+		case 'T', 'U':
+			txn.amount = value
+		case 'P':
+			txn.payee = value
+		case 'L':
+			txn.category = value
+		case 'M':
+			txn.memo = value
+		case 'S':
+			txn.splits = append(txn.splits, qifSplit{category: value})
+		case 'E':
+			if len(txn.splits) > 0 {
+				txn.splits[len(txn.splits)-1].memo = value
+			}
+		case '$':
+			if len(txn.splits) > 0 {
+				txn.splits[len(txn.splits)-1].amount = value
+			}
+		case '^':
+			err := qifInput.addTransaction(txn)
+			if err != nil {
+				log.Printf("%v:%v: skipping transaction: %v\n", qifInput.name, lineNo, err)
+			}
+			txn = qifTransaction{}
+		}
+	}
+	return qifInput, scanner.Err()
+}
+
+func (qifInput *QIFInput) addTransaction(txn qifTransaction) error {
+	date, err := ParseQIFDate(txn.date)
+	if err != nil {
+		return err
+	}
+	amount, err := ParseAmount(txn.amount, '.')
+	if err != nil {
+		return err
+	}
+	var splits []QIFSplit
+	for _, split := range txn.splits {
+		part, err := ParseAmount(split.amount, '.')
+		if err != nil {
+			return err
+		}
+		splits = append(splits, QIFSplit{Category: split.category, Memo: split.memo, Amount: -part})
+	}
+
+	var credit, debit money.Amount
+	if amount < 0 {
+		credit = -amount
+	} else {
+		debit = amount
+	}
+	qifInput.rows = append(qifInput.rows, []string{
+		date.Format(QIFTimeFormat),
+		txn.payee,
+		formatAmount(credit),
+		formatAmount(debit),
+		"",
+		txn.category,
+		txn.memo,
+	})
+	qifInput.splits = append(qifInput.splits, splits)
+	return nil
+}
+
+// ParseQIFDate parses the month first dates QIF files use, such as
+// "01/03/2019", "1/ 3/19" and "1/3'19", where an apostrophe marks a year
+// of the 2000s.
+func ParseQIFDate(s string) (time.Time, error) {
+	var fields []int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == '\''
+	}) {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Bad QIF date %q", s)
+		}
+		fields = append(fields, n)
+	}
+	if len(fields) != 3 {
+		return time.Time{}, fmt.Errorf("Bad QIF date %q", s)
+	}
+
+	month, day, year := fields[0], fields[1], fields[2]
+	switch {
+	case strings.Contains(s, "'") && year < 100:
+		year += 2000
+	case year < 70:
+		year += 2000
+	case year < 100:
+		year += 1900
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("Bad QIF date %q", s)
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+}
+
+// ReadRow returns the next row of the file, or nil when all have been read.
+func (qifInput *QIFInput) ReadRow() []string {
+	if len(qifInput.rows) == 0 {
+		qifInput.last = nil
+		return nil
+	}
+	row := qifInput.rows[0]
+	qifInput.last = qifInput.splits[0]
+	qifInput.rows = qifInput.rows[1:]
+	qifInput.splits = qifInput.splits[1:]
+	return row
+}
+
+// Splits returns the split lines of the transaction ReadRow returned last.
+func (qifInput *QIFInput) Splits() []QIFSplit {
+	return qifInput.last
+}
+
+func (qifInput *QIFInput) Name() string {
+	return qifInput.name
+}
+
+func (qifInput *QIFInput) Columns() []string {
+	return QIFColumns
+}
+
+func (qifInput *QIFInput) Types() []string {
+	return QIFTypes
+}
+
+func (qifInput *QIFInput) TimeFormat() string {
+	return QIFTimeFormat
+}
@@ -0,0 +1,94 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var simpleQIF = `!Account
+NChecking
+^
+!Type:Bank
+D01/03/2019
+T-20.50
+PSAFEWAY
+LGroceries
+^
+D1/ 4'19
+T1,000.00
+PACME PAYROLL
+LSalary
+MJanuary
+^
+!Type:CCard
+D01/05/19
+T-150.00
+PCOSTCO
+SGroceries
+$-100.00
+SHousehold
+EPaper towels
+$-50.00
+^
+D01/32/2019
+T-5.00
+PBAD DATE
+^
+D01/07/2019
+T-5.00
+PBAD SPLIT
+SGroceries
+$-5.0.0
+^
+!Type:Invst
+D01/06/2019
+T-10.00
+PBROKER
+^
+`
+
+func TestQIFInputReadsBlocks(t *testing.T) {
+	input, err := NewQIFInput(strings.NewReader(simpleQIF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		row    []string
+		splits []QIFSplit
+	}{
+		{[]string{"2019-01-03", "SAFEWAY", "20.5", "", "", "Groceries", ""}, nil},
+		{[]string{"2019-01-04", "ACME PAYROLL", "", "1000", "", "Salary", "January"}, nil},
+		{[]string{"2019-01-05", "COSTCO", "150", "", "", "", ""}, []QIFSplit{
+			{Category: "Groceries", Amount: 1000000},
+			{Category: "Household", Memo: "Paper towels", Amount: 500000},
+		}},
+	}
+	// The transactions with a bad date or split amount are skipped.
+	for _, e := range expected {
+		row := input.ReadRow()
+		if !reflect.DeepEqual(row, e.row) {
+			t.Errorf("ReadRow() = %v, want %v", row, e.row)
+		}
+		if splits := input.Splits(); !reflect.DeepEqual(splits, e.splits) {
+			t.Errorf("Splits() = %v, want %v", splits, e.splits)
+		}
+	}
+	if row := input.ReadRow(); row != nil {
+		t.Errorf("ReadRow() = %v, want nil", row)
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	want := time.Date(2019, 1, 4, 0, 0, 0, 0, time.UTC)
+	for _, s := range []string{"01/04/2019", "1/ 4'19", "1/4/19", "1-4-2019"} {
+		got, err := ParseQIFDate(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseQIFDate(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseQIFDate("13/01/2019"); err == nil {
+		t.Errorf("ParseQIFDate accepted month 13")
+	}
+}
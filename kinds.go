@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"./money"
+)
+
+// Kinds of categories. Cash flow counts income and expenses and leaves
+// transfers between our own accounts out; the spending reports only show
+// expenses.
+const (
+	KindIncome   = "income"
+	KindExpense  = "expense"
+	KindTransfer = "transfer"
+)
+
+// CategoryKind marks a category, and the subcategories not marked
+// themselves, as income, expense or transfer.
+type CategoryKind struct {
+	Category string
+	Kind     string
+}
+
+// kindSet maps categories to their kind.
+type kindSet map[string]string
+
+func (ms *MoneySense) loadKinds() kindSet {
+	kinds := make(kindSet)
+
+	rows, err := ms.store.Query(`SELECT category, kind FROM ms_kinds`)
+	if err != nil {
+		log.Fatal("Failed to query category kinds: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k CategoryKind
+		err = rows.Scan(&k.Category, &k.Kind)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kinds[k.Category] = k.Kind
+	}
+	return kinds
+}
+
+// of returns the kind of category, the one of its closest marked ancestor
+// or expense if there is none. A transaction without a category is income
+// when money came in.
+func (k kindSet) of(category string, amount money.Amount) string {
+	if category == "" {
+		if amount < 0 {
+			return KindIncome
+		}
+		return KindExpense
+	}
+	for depth := categoryDepth(category); depth > 0; depth-- {
+		if kind, ok := k[categoryAtDepth(category, depth)]; ok {
+			return kind
+		}
+	}
+	return KindExpense
+}
+
+func (ms *MoneySense) Kinds() []CategoryKind {
+	var result []CategoryKind
+	for category, kind := range ms.loadKinds() {
+		result = append(result, CategoryKind{Category: category, Kind: kind})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Category < result[j].Category
+	})
+	return result
+}
+
+// SetKind marks category as kind, expense being the default.
+func (ms *MoneySense) SetKind(category string, kind string) error {
+	ms.warnInMemory()
+	switch kind {
+	case KindIncome, KindTransfer:
+		_, err := ms.store.Exec(`INSERT OR REPLACE INTO ms_kinds(category, kind) VALUES(?, ?)`, category, kind)
+		return err
+	case KindExpense:
+		_, err := ms.store.Exec(`DELETE FROM ms_kinds WHERE category = ?`, category)
+		if err != nil {
+			return err
+		}
+		// A subcategory of income is only an expense if it says so.
+		if ms.loadKinds().of(category, 0) != KindExpense {
+			_, err = ms.store.Exec(`INSERT INTO ms_kinds(category, kind) VALUES(?, ?)`, category, kind)
+		}
+		return err
+	}
+	return fmt.Errorf("Unknown kind %q, want one of %v", kind, strings.Join([]string{KindIncome, KindExpense, KindTransfer}, ", "))
+}
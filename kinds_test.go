@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"./money"
+)
+
+func TestKindSetOf(t *testing.T) {
+	kinds := kindSet{
+		"Income":               KindIncome,
+		"Income:Refunds":       KindExpense,
+		"Transfers":            KindTransfer,
+		"Transfers:Mortgage":   KindExpense,
+		"Food:Restaurants:Tip": KindExpense,
+	}
+	cases := []struct {
+		category string
+		amount   money.Amount
+		expected string
+	}{
+		{"Income", -1000, KindIncome},
+		{"Income:Salary", -1000, KindIncome},
+		{"Income:Refunds:Amazon", -1000, KindExpense},
+		{"Transfers:Savings", 1000, KindTransfer},
+		{"Transfers:Mortgage", 1000, KindExpense},
+		{"Food", 1000, KindExpense},
+		{"Food", -1000, KindExpense},
+		// Without a category money coming in is income.
+		{"", -1000, KindIncome},
+		{"", 1000, KindExpense},
+	}
+	for _, c := range cases {
+		if kind := kinds.of(c.category, c.amount); kind != c.expected {
+			t.Errorf("of(%q, %v) = %v, expected %v", c.category, c.amount, kind, c.expected)
+		}
+	}
+}
+
+func TestCashFlowPeriodSavings(t *testing.T) {
+	p := CashFlowPeriod{Income: 300000, Expenses: 350000, Transfers: 100000}
+	if p.Savings() != -50000 {
+		t.Errorf("Expected savings of -50000, got %v", p.Savings())
+	}
+}
+
+func TestCashFlowChecksPeriod(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{}, MoneySenseOptions{})
+	if _, err := ms.CashFlow("01/01/2019", "01/31/2019", "quartr"); err == nil {
+		t.Errorf("Expected a bad period to fail without records")
+	}
+	if _, err := ms.CashFlow("01/01/2019", "01/31/2019", BudgetMonthly); err != nil {
+		t.Errorf("CashFlow() = %v", err)
+	}
+}
@@ -2,62 +2,338 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"./input"
+	"./money"
 	"./output"
 	"./storage"
 )
 
 const TimeFormat = "01/02/2006"
 
+// signedAmount is the amount of a history row as money out, credit being
+// what was spent and debit what came in, so income and refunds are
+// negative, in minor units of money.MaxDigits digits.
+var signedAmount = toMaxDigits("IFNULL(credit, 0) - IFNULL(debit, 0)", "")
+
 type MoneySense struct {
 	store          *storage.Storage
 	historyPath    string
 	history        string
 	classifierPath string
 	classifier     string
+	budgetsPath    string
+	budgets        string
+	accountsPath   string
+	accounts       string
+	batch          bool
+	pendingPath    string
+	uncategorized  string
+	transferDays   int
+	base           string
+	rates          string
+	// missingRates are the currencies reported to have no exchange rate
+	// into the base currency.
+	missingRates map[string]bool
+	// dbPath is the database file, empty when everything is in memory,
+	// and warnedInMemory set once the user was told what that loses.
+	dbPath         string
+	warnedInMemory bool
+	// accountFilter are the accounts the history is narrowed down to, all
+	// of them if it is empty.
+	accountFilter []string
+}
+
+// MoneySenseOptions are the sources MoneySense is built from.
+type MoneySenseOptions struct {
+	// HistoryPath is a csv file or a directory of them holding transactions.
+	HistoryPath string
+	// ClassifierPath is the csv file mapping mechants to categories.
+	ClassifierPath string
+	// BudgetsPath is the csv file of budgets, they are only kept in the
+	// database if it is empty.
+	BudgetsPath string
+	// AccountsPath is the csv file of the accounts registry, it is only
+	// kept in the database if it is empty.
+	AccountsPath string
+	// DBPath is the SQLite database file, everything is kept in memory if
+	// it is empty.
+	DBPath string
+	// Profiles are the bank import profiles raw history exports are read
+	// with.
+	Profiles []*input.Profile
+	// Batch classifies without asking, mechants no rule matches are
+	// written to PendingPath for review instead if it is set, and only
+	// counted otherwise.
+	Batch       bool
+	PendingPath string
+	// Uncategorized, if set, is the category reports put transactions no
+	// rule matches in, rather than leaving them out.
+	Uncategorized string
+	// TransferDays is how many days apart the two sides of a transfer
+	// between our accounts may be posted.
+	TransferDays int
+	// Base is the currency reports are converted into, amounts are left
+	// in their own currency if it is empty.
+	Base string
+	// RatesPath is the csv file of exchange rates.
+	RatesPath string
 }
 
+// Record is an amount in the base currency, Original being the amount in
+// the currency it was made in.
 type Record struct {
 	Date     time.Time
-	Amount   float64
+	Amount   money.Amount
 	Category string
+	Kind     string
+	Currency string
+	Original money.Amount
 }
 
-func NewMoneySense(historyPath string, classifierPath string) (*MoneySense, error) {
-	store := storage.NewStorage()
+func NewMoneySense(opts *MoneySenseOptions) (*MoneySense, error) {
+	store := storage.NewStorage(opts.DBPath)
 
-	historyName, err := loadData(historyPath, store)
+	splits := make(map[string][]Split)
+	historyName, err := loadData(opts.HistoryPath, store, true, opts.Profiles, splits)
 	if err != nil {
 		return nil, err
 	}
 
-	classifierName, err := loadData(classifierPath, store)
+	classifierName, err := loadData(opts.ClassifierPath, store, false, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &MoneySense{
+	budgetsName := "ms_budgets"
+	if opts.BudgetsPath != "" {
+		err = createTableFile(opts.BudgetsPath, budgetTypes, budgetColumns)
+		if err != nil {
+			return nil, err
+		}
+		budgetsName, err = loadData(opts.BudgetsPath, store, false, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accountsName := "ms_accounts"
+	if opts.AccountsPath != "" {
+		err = createTableFile(opts.AccountsPath, accountTypes, accountColumns)
+		if err != nil {
+			return nil, err
+		}
+		accountsName, err = loadData(opts.AccountsPath, store, false, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ratesName string
+	if opts.RatesPath != "" {
+		ratesName, err = loadData(opts.RatesPath, store, false, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ms := &MoneySense{
 		store:          store,
-		historyPath:    historyPath,
+		historyPath:    opts.HistoryPath,
 		history:        historyName,
-		classifierPath: classifierPath,
+		classifierPath: opts.ClassifierPath,
 		classifier:     classifierName,
-	}, nil
+		budgetsPath:    opts.BudgetsPath,
+		budgets:        budgetsName,
+		accountsPath:   opts.AccountsPath,
+		accounts:       accountsName,
+		batch:          opts.Batch,
+		pendingPath:    opts.PendingPath,
+		uncategorized:  opts.Uncategorized,
+		transferDays:   opts.TransferDays,
+		base:           strings.ToUpper(opts.Base),
+		rates:          ratesName,
+		dbPath:         opts.DBPath,
+	}
+	err = ms.createTables()
+	if err != nil {
+		return nil, err
+	}
+	err = ms.store.EnsureColumns(ms.classifier, ruleColumns, ruleTypes)
+	if err != nil {
+		return nil, err
+	}
+	err = ms.store.EnsureColumns(ms.budgets, budgetColumns, budgetTypes)
+	if err != nil {
+		return nil, err
+	}
+	err = ms.store.EnsureColumns(ms.accounts, accountColumns, accountTypes)
+	if err != nil {
+		return nil, err
+	}
+	if ms.rates != "" {
+		err = ms.store.EnsureColumns(ms.rates, rateColumns, rateTypes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ms.rescaleAmounts()
+	if err != nil {
+		return nil, err
+	}
+	ms.importSplits(splits)
+	err = ms.warnMixedCurrencies()
+	if err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// createTables creates the tables MoneySense keeps next to the imported
+// history and classifier.
+func (ms *MoneySense) createTables() error {
+	err := ms.store.EnsureColumns(ms.history, []string{FingerprintColumn, "credit", "debit", AccountColumn, CurrencyColumn}, []string{"TEXT", input.AmountType, input.AmountType, "TEXT", "TEXT"})
+	if err != nil {
+		return err
+	}
+
+	// Amounts are kept in minor units of the currency of their row, see
+	// rescaleAmounts.
+	amount := input.AmountType
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ms_dupok (a TEXT, b TEXT)`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS ms_splits (txid TEXT, category TEXT, amount %v)`, amount),
+		`CREATE TABLE IF NOT EXISTS ms_overrides (txid TEXT PRIMARY KEY, category TEXT)`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%v" (category TEXT, period TEXT, amount %v, rollover TEXT, cap %v)`, ms.budgets, amount, amount),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS ms_allocations (date TIMESTAMP, category TEXT, amount %v)`, amount),
+		`CREATE TABLE IF NOT EXISTS ms_kinds (category TEXT PRIMARY KEY, kind TEXT)`,
+		`CREATE TABLE IF NOT EXISTS ms_transfers (a TEXT, b TEXT, status TEXT)`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%v" (name TEXT, type TEXT, currency TEXT, institution TEXT, opening %v, opened TIMESTAMP)`, ms.accounts, amount),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS ms_reconciliations (account TEXT, date TIMESTAMP, statement %v, computed %v)`, amount, amount),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS ms_goals (name TEXT PRIMARY KEY, target %v, deadline TIMESTAMP, account TEXT, category TEXT, start TIMESTAMP)`, amount),
+	}
+	for _, stmt := range stmts {
+		_, err := ms.store.Exec(stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Databases and csv files from before amounts were exact hold them
+	// as decimals.
+	for _, t := range ms.amountTables() {
+		err = ms.store.ConvertAmounts(t.name, t.columns...)
+		if err != nil {
+			return err
+		}
+		err = ms.store.EnsureColumns(t.name, []string{storage.DigitsColumn}, []string{"INTEGER"})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// amountTable is a table with money columns, rows selecting the rowid,
+// account and currency of its rows that are not yet in the minor units of
+// their currency.
+type amountTable struct {
+	name    string
+	columns []string
+	rows    string
+}
+
+func (ms *MoneySense) amountTables() []amountTable {
+	digits := storage.DigitsColumn
+	return []amountTable{
+		{ms.history, []string{"credit", "debit"}, fmt.Sprintf(`SELECT rowid, IFNULL(%v, '%v'), IFNULL(%v, '') FROM "%v" WHERE %v IS NULL`,
+			AccountColumn, DefaultAccount, CurrencyColumn, ms.history, digits)},
+		{ms.budgets, []string{"amount", "cap"}, fmt.Sprintf(`SELECT rowid, '', '' FROM "%v" WHERE %v IS NULL`, ms.budgets, digits)},
+		{ms.accounts, []string{"opening"}, fmt.Sprintf(`SELECT rowid, '', IFNULL(currency, '') FROM "%v" WHERE %v IS NULL`, ms.accounts, digits)},
+		{"ms_splits", []string{"amount"}, fmt.Sprintf(`SELECT s.rowid, IFNULL(h.%v, '%v'), IFNULL(h.%v, '') FROM ms_splits s LEFT JOIN "%v" h ON h.%v = s.txid WHERE s.%v IS NULL`,
+			AccountColumn, DefaultAccount, CurrencyColumn, ms.history, FingerprintColumn, digits)},
+		{"ms_allocations", []string{"amount"}, fmt.Sprintf(`SELECT rowid, '', '' FROM ms_allocations WHERE %v IS NULL`, digits)},
+		{"ms_reconciliations", []string{"statement", "computed"}, fmt.Sprintf(`SELECT rowid, account, '' FROM ms_reconciliations WHERE %v IS NULL`, digits)},
+		{"ms_goals", []string{"target"}, fmt.Sprintf(`SELECT rowid, IFNULL(account, ''), '' FROM ms_goals WHERE %v IS NULL`, digits)},
+	}
 }
 
-func loadData(filePath string, store *storage.Storage) (string, error) {
+// rescaleAmounts turns the amounts loaded from files, and the ones of
+// databases from before amounts were kept in the minor units of their
+// currency, into those. Amounts finer than them are rounded and logged.
+func (ms *MoneySense) rescaleAmounts() error {
+	currencies := ms.accountCurrencies()
+	for _, t := range ms.amountTables() {
+		rows, err := ms.store.Query(t.rows)
+		if err != nil {
+			return err
+		}
+		digits := make(map[int64]int)
+		for rows.Next() {
+			var rowid int64
+			var account, currency string
+			err = rows.Scan(&rowid, &account, &currency)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			digits[rowid] = ms.rowDigits(account, currency, currencies)
+		}
+		rows.Close()
+		if len(digits) == 0 {
+			continue
+		}
+		rounded, err := ms.store.RescaleAmounts(t.name, t.columns, digits)
+		if err != nil {
+			return err
+		}
+		if len(rounded) > 0 {
+			log.Printf("Rounded %v amounts of %v finer than the minor unit of their currency, such as row %v\n", len(rounded), t.name, rounded[0])
+		}
+	}
+	return nil
+}
+
+// toMaxDigits scales expr, made of money columns of the table named prefix
+// if any, from the minor units of its row to ones of money.MaxDigits
+// digits.
+func toMaxDigits(expr string, prefix string) string {
+	var cases []string
+	for d := 0; d < money.MaxDigits; d++ {
+		cases = append(cases, fmt.Sprintf("WHEN %v THEN %v", d, int64(money.Amount(1).Rescale(d, money.MaxDigits))))
+	}
+	return fmt.Sprintf("(%v) * CASE %v%v %v ELSE 1 END", expr, prefix, storage.DigitsColumn, strings.Join(cases, " "))
+}
+
+// readers open the files loadData imports, by extension.
+var readers = map[string]func(f *os.File, profiles []*input.Profile) (input.Input, error){
+	".csv": openCSVInput,
+	".ofx": openOFXInput,
+	".qfx": openOFXInput,
+	".qif": openQIFInput,
+}
+
+// loadData loads every statement file under filePath into one table named
+// after it. With dedup set, rows already present in the table are skipped
+// and the rows are tagged with their account.
+// Csv files matching one of profiles are read through it, the others must
+// have the two-row type/name header. The split lines of the QIF files
+// loaded with dedup are collected into splits by fingerprint.
+func loadData(filePath string, store *storage.Storage, dedup bool, profiles []*input.Profile, splits map[string][]Split) (string, error) {
 	fi, err := os.Stat(filePath)
 	if err != nil {
-		log.Fatal("Failed to get the status of file %v\n", filePath)
+		log.Fatalf("Failed to get the status of file %v\n", filePath)
 	}
 
 	var tableName string
@@ -68,33 +344,15 @@ func loadData(filePath string, store *storage.Storage) (string, error) {
 		extension := path.Ext(filePath)
 		tableName = path.Base(filePath[0 : len(filePath)-len(extension)])
 	}
+	singleFile := fi.Mode().IsRegular()
 
 	err = filepath.Walk(filePath, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
 			fmt.Printf("prevent panic by handling failure accessing a path %q: %v\n", p, err)
 			return err
 		}
-		if path.Ext(p) == ".csv" {
-			fmt.Println("loadData on", p)
-			reader, err := os.Open(p)
-			if err != nil {
-				log.Fatal("Could not open %q", p)
-			}
-
-			opts := &input.CSVInputOptions{
-				Separator:  ',',
-				ReadFrom:   reader,
-				TimeFormat: TimeFormat,
-			}
-
-			csvInput, err := input.NewCSVInput(opts)
-			if err != nil {
-				log.Fatal("Could not create new CSVInput")
-			}
-			err = store.Load(tableName, csvInput)
-			if err != nil {
-				log.Fatal("Could not load csv file into Storage")
-			}
+		if _, ok := readers[strings.ToLower(path.Ext(p))]; ok && info.Mode().IsRegular() {
+			loadFile(filePath, p, store, tableName, singleFile, dedup, profiles, splits)
 		}
 		return err
 	})
@@ -103,6 +361,127 @@ func loadData(filePath string, store *storage.Storage) (string, error) {
 	return tableName, err
 }
 
+// loadFile imports the file at p, found under filePath, into tableName
+// unless it was imported as it is already. The rows of an earlier version
+// of the file are replaced, the whole table when it mirrors the one file.
+func loadFile(filePath string, p string, store *storage.Storage, tableName string, singleFile bool, dedup bool, profiles []*input.Profile, splits map[string][]Split) {
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hash, err := hashFile(p)
+	if err != nil {
+		log.Fatalf("Could not hash %q: %v", p, err)
+	}
+	importedHash, err := store.ImportedHash(absPath)
+	if err != nil {
+		log.Fatal("Could not look up import history:", err)
+	}
+	if importedHash == hash {
+		fmt.Println("loadData skips already imported", p)
+		return
+	}
+	if importedHash != "" && singleFile {
+		_, err = store.Exec(fmt.Sprintf(`DELETE FROM "%v"`, tableName))
+		if err != nil {
+			log.Fatalf("Could not clear table %v: %v", tableName, err)
+		}
+	} else if importedHash != "" {
+		err = store.DeleteImported(absPath)
+		if err != nil {
+			log.Fatalf("Could not delete the rows of %v: %v", p, err)
+		}
+	}
+
+	fmt.Println("loadData on", p)
+	reader, err := os.Open(p)
+	if err != nil {
+		log.Fatalf("Could not open %q", p)
+	}
+	defer reader.Close()
+
+	in, err := readers[strings.ToLower(path.Ext(p))](reader, profiles)
+	if err != nil {
+		log.Fatalf("Could not read %q: %v", p, err)
+	}
+	var dedupIn *dedupInput
+	if dedup {
+		qif, isQIF := in.(*input.QIFInput)
+		in = withAccount(in, filePath, p)
+		dedupIn = newDedupInput(in, store, tableName)
+		in = dedupIn
+		if isQIF {
+			in = &splitsInput{Input: in, qif: qif, splits: splits}
+		}
+	}
+	err = store.Import(absPath, hash, tableName, in)
+	if err != nil {
+		log.Fatal("Could not load csv file into Storage", err)
+	}
+	if dedupIn != nil && dedupIn.Skipped > 0 {
+		fmt.Printf("loadData skips %v duplicate rows in %v\n", dedupIn.Skipped, p)
+	}
+}
+
+// openCSVInput reads f through the import profile selected for it, or as a
+// csv with the two-row type/name header when no profile applies.
+func openCSVInput(f *os.File, profiles []*input.Profile) (input.Input, error) {
+	var head []string
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 16 && scanner.Scan(); i++ {
+		head = append(head, scanner.Text())
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := input.SelectProfile(profiles, f.Name(), head)
+	if profile != nil {
+		fmt.Println("Reading", f.Name(), "with profile", profile.Name)
+		return input.NewProfileInput(profile, f)
+	}
+
+	opts := &input.CSVInputOptions{
+		Separator:  ',',
+		ReadFrom:   f,
+		TimeFormat: TimeFormat,
+	}
+	return input.NewCSVInput(opts)
+}
+
+func openOFXInput(f *os.File, profiles []*input.Profile) (input.Input, error) {
+	return input.NewOFXInput(f)
+}
+
+func openQIFInput(f *os.File, profiles []*input.Profile) (input.Input, error) {
+	return input.NewQIFInput(f)
+}
+
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// warnInMemory warns, once a run, that without a database file what the
+// user records beyond the classifier, budgets and accounts is lost on exit.
+func (ms *MoneySense) warnInMemory() {
+	if ms.dbPath != "" || ms.warnedInMemory {
+		return
+	}
+	ms.warnedInMemory = true
+	log.Println("Warning: overrides, splits, kinds, transfers, goals, allocations and reviewed duplicates are only kept in memory and lost on exit, use -db to keep them.")
+}
+
 func (ms *MoneySense) Close() error {
 	err := ms.store.Close()
 	if err != nil {
@@ -112,100 +491,340 @@ func (ms *MoneySense) Close() error {
 	return err
 }
 
-func (ms *MoneySense) Classify() error {
-	query := fmt.Sprintf(`SELECT date, mechant, IFNULL(credit, 0) FROM %v`, ms.history)
+// ClassifySummary counts what Classify did with the history.
+type ClassifySummary struct {
+	Transactions int
+	Classified   int
+	Learned      int
+	// Pending are the mechants left for review in batch mode.
+	Pending int
+}
+
+// Classify makes sure a rule matches every transaction of the history,
+// asking for the category of unknown mechants. In batch mode it asks
+// nothing and writes unknown mechants to the pending review file.
+func (ms *MoneySense) Classify() (ClassifySummary, error) {
+	var summary ClassifySummary
+	var transactions []Transaction
+
+	query := fmt.Sprintf(`SELECT date, mechant, %v, %v FROM %v`, signedAmount, ms.importedCategory(), ms.history)
 	rows, err := ms.store.Query(query)
 	if err != nil {
 		log.Fatalf("Failed to query storage! %q, err=%v", query, err)
 	}
-	defer rows.Close()
 	for rows.Next() {
-		var date time.Time
-		var mechant, category string
-		var credit float64
-		var changed bool
-		err = rows.Scan(&date, &mechant, &credit)
+		var t Transaction
+		err = rows.Scan(&t.Date, &t.Mechant, &t.Amount, &t.ImportedCategory)
 		if err != nil {
 			log.Fatal(err)
 		}
-		query := fmt.Sprintf(`SELECT category FROM "%v" WHERE mechant == "%v"`, ms.classifier, mechant)
-		err = ms.store.QueryRow(query).Scan(&category)
-		if err == sql.ErrNoRows {
-			fmt.Printf("What is the category of %v?\n", mechant)
-			reader := bufio.NewReader(os.Stdin)
-			input, err := reader.ReadString('\n')
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+
+	rules, err := ms.loadRules()
+	if err != nil {
+		log.Fatal("Failed to load classifier rules: ", err)
+	}
+	suggester := trainSuggester(rules, transactions)
+	pending := newPendingReview()
+	// Once the input runs out, the mechants left are not asked about.
+	asking := !ms.batch
+	summary.Transactions = len(transactions)
+	for _, t := range transactions {
+		var category string
+
+		// Files such as QIF carry the category of every row, or of every
+		// split of a transaction, which is reported as is.
+		if t.ImportedCategory != "" {
+			fmt.Printf("Classify %v as imported %v\n", t.Mechant, t.ImportedCategory)
+			summary.Classified++
+			continue
+		}
+
+		amount := t.Amount.Float(money.MaxDigits)
+		rule := rules.Find(t.Mechant, amount, t.Date)
+		if rule != nil {
+			fmt.Printf("Classify %v as %v\n", t.Mechant, rule.Category)
+			summary.Classified++
+			continue
+		}
+
+		if !asking {
+			pending.add(t, suggester.Suggest(t.Mechant, amount, 1))
+			continue
+		} else {
+			suggestions := suggester.Suggest(t.Mechant, amount, 3)
+			fmt.Printf("What is the category of %v?\n", t.Mechant)
+			for i, sg := range suggestions {
+				fmt.Printf("  %v) %v (%.0f%%)\n", i+1, sg.Category, sg.Confidence*100)
+			}
+			if len(suggestions) > 0 {
+				fmt.Println("Type a category, the number of a suggestion, or Enter to accept 1.")
+			}
+			input, err := stdin.ReadString('\n')
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			} else {
-				category = strings.TrimSuffix(input, "\n")
-				insert := fmt.Sprintf(`INSERT INTO "%v"(mechant, category) VALUES("%v", "%v")`, ms.classifier, mechant, category)
-				_, err = ms.store.Exec(insert)
-				if err != nil {
-					log.Fatal("Failed to insert category information")
+				if err != io.EOF {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				fmt.Println("No more answers, leaving the mechants left unclassified.")
+				asking = false
+				// An answer on the last line without a newline still counts.
+				if strings.TrimSpace(input) == "" {
+					pending.add(t, suggestions)
+					continue
 				}
 			}
-			changed = true
-		} else if err != nil {
-			log.Fatalf("Failed to classify: %v, err=%v\n", query, err)
-		} else {
-			fmt.Printf("Classify %v as %v\n", mechant, category)
+			category = pickSuggestion(strings.TrimSpace(input), suggestions)
 		}
 
-		if changed {
-			writer, err := os.OpenFile(ms.classifierPath, os.O_WRONLY, 0600)
+		if category != "" {
+			summary.Classified++
+			summary.Learned++
+			suggester.Train(t.Mechant, amount, category)
+			err = ms.AddRule(MatchExact, t.Mechant, category, 0)
 			if err != nil {
-				log.Fatalf("Could not open %q", ms.classifierPath)
-			}
-
-			csvOutputOptions := output.CSVOutputOptions{
-				Separator:  ',',
-				WriteTo:    writer,
-				TimeFormat: TimeFormat,
+				log.Fatal("Failed to insert category information")
 			}
-			csvOutput := output.NewCSVOutput(&csvOutputOptions)
-			err = ms.store.Save(ms.classifier, csvOutput)
+			rules, err = ms.loadRules()
 			if err != nil {
-				log.Fatal("Failed to save new classified data", err)
+				log.Fatal("Failed to load classifier rules: ", err)
 			}
+			ms.saveClassifier()
 		}
 	}
-	return nil
+
+	summary.Pending = len(pending.mechants)
+	if ms.batch && ms.pendingPath != "" {
+		err = pending.write(ms.pendingPath)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
 }
 
-func (ms *MoneySense) Retrieve(category string, start string, end string) []Record {
-	var result []Record
+// pickSuggestion turns an answer to the category prompt into a category:
+// nothing accepts the first suggestion and a number picks one.
+func pickSuggestion(answer string, suggestions []Suggestion) string {
+	if answer == "" {
+		if len(suggestions) > 0 {
+			return suggestions[0].Category
+		}
+		return ""
+	}
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(suggestions) {
+		return suggestions[n-1].Category
+	}
+	return answer
+}
 
-	start_dt, err := time.Parse(TimeFormat, start)
+// saveClassifier writes the classifier table back to its file.
+func (ms *MoneySense) saveClassifier() {
+	ms.saveTable(ms.classifier, ms.classifierPath)
+}
+
+// saveTable writes table back to the file it was loaded from.
+func (ms *MoneySense) saveTable(table string, filePath string) {
+	writer, err := os.OpenFile(filePath, os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatal("Failed to parse date:", start)
+		log.Fatalf("Could not open %q", filePath)
 	}
 
+	csvOutputOptions := output.CSVOutputOptions{
+		Separator:  ',',
+		WriteTo:    writer,
+		TimeFormat: TimeFormat,
+	}
+	csvOutput := output.NewCSVOutput(&csvOutputOptions)
+	err = ms.store.Save(table, csvOutput)
+	if err != nil {
+		log.Fatalf("Failed to save %v: %v", table, err)
+	}
+	writer.Close()
+	ms.rememberFile(table, filePath)
+}
+
+// rememberFile records a rewritten file as imported so the next start
+// does not load our own output a second time.
+func (ms *MoneySense) rememberFile(table string, filePath string) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hash, err := hashFile(filePath)
+	if err != nil {
+		log.Fatalf("Could not hash %q: %v", filePath, err)
+	}
+	err = ms.store.MarkImported(absPath, hash, table)
+	if err != nil {
+		log.Fatal("Could not record saved file", err)
+	}
+}
+
+// Transaction is a history row with the category it is reported under.
+type Transaction struct {
+	ID      string
+	Account string
+	Date    time.Time
+	Mechant string
+	// Amount is the money that went out, negative if it came in, in the
+	// base currency.
+	Amount money.Amount
+	// Original is Amount in Currency, the currency of the transaction.
+	Original money.Amount
+	Currency string
+	Category string
+	// ImportedCategory is the category the row was imported with, if any.
+	ImportedCategory string
+	// Overridden is set when Category comes from an override.
+	Overridden bool
+	// converted is set when Amount is Original in the base currency, which
+	// it is not without a base currency or an exchange rate.
+	converted bool
+}
+
+// categorizer gives transactions the category they are reported under: an
+// override wins over the category the row was imported with, which wins
+// over the classifier rules, and transactions none of them covers get the
+// uncategorized bucket, if any.
+type categorizer struct {
+	rules         RuleSet
+	overrides     map[string]string
+	uncategorized string
+}
+
+func (ms *MoneySense) newCategorizer() (*categorizer, error) {
+	rules, err := ms.loadRules()
+	if err != nil {
+		return nil, err
+	}
+	return &categorizer{
+		rules:         rules,
+		overrides:     ms.loadOverrides(),
+		uncategorized: ms.uncategorized,
+	}, nil
+}
+
+func (c *categorizer) categorize(t *Transaction) {
+	if category, ok := c.overrides[t.ID]; ok {
+		t.Category = category
+		t.Overridden = true
+	} else if t.ImportedCategory != "" {
+		t.Category = t.ImportedCategory
+	} else if rule := c.rules.Find(t.Mechant, t.Original.Float(money.Digits(t.Currency)), t.Date); rule != nil {
+		t.Category = rule.Category
+	} else {
+		t.Category = c.uncategorized
+	}
+}
+
+// Transactions lists the history between start and end whose mechant
+// contains pattern, each with the category it is reported under and its
+// amount converted into the base currency at the rate of its date.
+func (ms *MoneySense) Transactions(start string, end string, pattern string) ([]Transaction, error) {
+	var result []Transaction
+
+	start_dt, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse date: %v", start)
+	}
 	end_dt, err := time.Parse(TimeFormat, end)
 	if err != nil {
-		log.Fatal("Failed to parse date:", end)
+		return nil, fmt.Errorf("Failed to parse date: %v", end)
+	}
+	c, err := ms.newCategorizer()
+	if err != nil {
+		return nil, err
 	}
 
-	QUERY := fmt.Sprintf(`SELECT date, IFNULL(credit, 0), category FROM %v INNER JOIN %v ON %v.mechant = %v.mechant WHERE date >= '%v' AND date <= '%v' ORDER BY date ASC`,
-		ms.history, ms.classifier, ms.history, ms.classifier, start_dt, end_dt)
-	rows, err := ms.store.Query(QUERY)
+	rates := ms.loadRates()
+	currencies := ms.accountCurrencies()
+
+	query := fmt.Sprintf(`SELECT IFNULL(%v, ''), IFNULL(%v, '%v'), date, mechant, %v, IFNULL(%v, ''), %v FROM %v
+		WHERE date >= '%v' AND date <= '%v' AND %v ORDER BY date ASC`,
+		FingerprintColumn, AccountColumn, DefaultAccount, signedAmount, CurrencyColumn, ms.importedCategory(), ms.history, start_dt, end_dt, ms.accountCondition(""))
+	rows, err := ms.store.Query(query)
 	if err != nil {
-		log.Fatal("query data base failed!: ", err)
+		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var r Record
-
-		err = rows.Scan(&r.Date, &r.Amount, &r.Category)
+		var t Transaction
+		var amount money.Amount
+		err = rows.Scan(&t.ID, &t.Account, &t.Date, &t.Mechant, &amount, &t.Currency, &t.ImportedCategory)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		if !strings.Contains(strings.ToUpper(t.Mechant), strings.ToUpper(pattern)) {
+			continue
+		}
+		err = ms.setAmount(&t, amount, rates, currencies)
+		if err == errNoRate {
+			continue
+		} else if err != nil {
+			return nil, err
 		}
-		if category == "*" || r.Category == category {
+		c.categorize(&t)
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// importedCategory is the column of the category rows were imported with,
+// empty for a history without one.
+func (ms *MoneySense) importedCategory() string {
+	if ms.store.HasColumn(ms.history, "category") {
+		return "IFNULL(category, '')"
+	}
+	return "''"
+}
+
+// digits are the digits of the minor unit of the base currency, which all
+// reported amounts are in.
+func (ms *MoneySense) digits() int {
+	return money.Digits(ms.base)
+}
+
+// Retrieve lists the expenses in category, and its subcategories, between
+// start and end. Refunds are negative expenses.
+func (ms *MoneySense) Retrieve(category string, start string, end string) []Record {
+	var result []Record
+
+	for _, r := range ms.Flows(start, end) {
+		if r.Kind == KindExpense && r.Category != "" && inCategory(r.Category, category) {
 			result = append(result, r)
 		}
-		fmt.Println("rows:", r)
 	}
-	if rows.Err() != nil {
-		log.Fatal(rows.Err())
+	return result
+}
+
+// Flows lists every record between start and end with the kind of its
+// category, including the transactions no rule matches. Both sides of a
+// transfer between our accounts are transfers whatever their category.
+func (ms *MoneySense) Flows(start string, end string) []Record {
+	var result []Record
+
+	transactions, err := ms.Transactions(start, end, "")
+	if err != nil {
+		log.Fatal("Failed to retrieve transactions: ", err)
+	}
+	splits := ms.loadSplits()
+	kinds := ms.loadKinds()
+	transfers := ms.transferIDs()
+
+	for _, t := range transactions {
+		// Splits are in the currency of the transaction.
+		records := splitRecords(t.Date, t.Original, money.Digits(t.Currency), t.Category, splits[t.ID])
+		convertRecords(records, t.Original, t.Amount)
+		for _, r := range records {
+			r.Currency = t.Currency
+			r.Kind = kinds.of(r.Category, r.Amount)
+			if transfers[t.ID] {
+				r.Kind = KindTransfer
+			}
+			result = append(result, r)
+		}
 	}
 	return result
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testClassifier and testHistory are an empty classifier and statement.
+const (
+	testClassifier = "TEXT,TEXT\nmechant,category\n"
+	testHistory    = "TIMESTAMP,TEXT,REAL\ndate,mechant,credit\n"
+)
+
+// newTestMoneySense builds a MoneySense on a database of its own from
+// files, the contents of csv files by name: the statements of the history
+// directory under "history/", in a directory named after their account,
+// and the classifier, accounts registry and
+// exchange rates in "classifier.csv", "accounts.csv" and "rates.csv" if
+// there are ones. Everything is removed when the test ends.
+func newTestMoneySense(t *testing.T, files map[string]string, opts MoneySenseOptions) *MoneySense {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	if _, ok := files["classifier.csv"]; !ok {
+		files["classifier.csv"] = testClassifier
+	}
+	history := false
+	for name := range files {
+		history = history || strings.HasPrefix(name, "history/")
+	}
+	if !history {
+		files["history/empty.csv"] = testHistory
+	}
+	for name, contents := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts.HistoryPath = filepath.Join(dir, "history")
+	opts.ClassifierPath = filepath.Join(dir, "classifier.csv")
+	opts.DBPath = filepath.Join(dir, "ms.db")
+	if _, ok := files["accounts.csv"]; ok {
+		opts.AccountsPath = filepath.Join(dir, "accounts.csv")
+	}
+	if _, ok := files["rates.csv"]; ok {
+		opts.RatesPath = filepath.Join(dir, "rates.csv")
+	}
+	ms, err := NewMoneySense(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ms.Close() })
+	return ms
+}
+
+func TestCategorize(t *testing.T) {
+	rule := &Rule{Pattern: "COSTCO", Match: MatchPrefix, Category: "shopping"}
+	rule.compile()
+	c := &categorizer{
+		rules:         RuleSet{rule},
+		overrides:     map[string]string{"tx1": "gifts", "tx2": "household"},
+		uncategorized: "other",
+	}
+	cases := []struct {
+		t          Transaction
+		category   string
+		overridden bool
+	}{
+		{Transaction{ID: "tx1", Mechant: "COSTCO WHSE"}, "gifts", true},
+		{Transaction{ID: "tx2", Mechant: "COSTCO WHSE", ImportedCategory: "grocery"}, "household", true},
+		{Transaction{ID: "tx3", Mechant: "COSTCO WHSE", ImportedCategory: "grocery"}, "grocery", false},
+		{Transaction{ID: "tx4", Mechant: "COSTCO WHSE"}, "shopping", false},
+		{Transaction{ID: "tx5", Mechant: "SAFEWAY"}, "other", false},
+	}
+	for _, tc := range cases {
+		tx := tc.t
+		c.categorize(&tx)
+		if tx.Category != tc.category || tx.Overridden != tc.overridden {
+			t.Errorf("%v: expected %v (override %v), got %v (override %v)", tx.ID, tc.category, tc.overridden, tx.Category, tx.Overridden)
+		}
+	}
+}
+
+func TestWarnInMemory(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	ms := &MoneySense{dbPath: "ms.db"}
+	ms.warnInMemory()
+	if logged.Len() != 0 {
+		t.Errorf("Expected no warning with a database file, got %q", logged.String())
+	}
+	ms = &MoneySense{}
+	ms.warnInMemory()
+	ms.warnInMemory()
+	if strings.Count(logged.String(), "Warning") != 1 {
+		t.Errorf("Expected one warning, got %q", logged.String())
+	}
+}
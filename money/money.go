@@ -0,0 +1,166 @@
+// Package money holds amounts as an integer number of the minor units of
+// their currency, so sums of many amounts are exact.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Amount is a number of minor units, such as cents. How many digits the
+// minor units are of the major unit depends on the currency, see Digits.
+type Amount int64
+
+// DefaultDigits are the digits of minor units of currencies not listed in
+// digits, and of amounts whose currency is not known.
+const DefaultDigits = 2
+
+// MaxDigits are the most digits of minor units of any currency. Amounts
+// parsed before their currency is known keep that many.
+const MaxDigits = 4
+
+// digits are the ISO 4217 minor unit digits of the currencies whose minor
+// unit is not a hundredth.
+var digits = map[string]int{
+	"BHD": 3, "BIF": 0, "CLF": 4, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3,
+	"ISK": 0, "JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3,
+	"OMR": 3, "PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "UYW": 4,
+	"VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// Digits returns the digits of the minor unit of currency.
+func Digits(currency string) int {
+	if d, ok := digits[strings.ToUpper(currency)]; ok {
+		return d
+	}
+	return DefaultDigits
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// Parse parses a bank formatted amount such as "1,234.56", "1.234,56",
+// "$12.00", "(12.00)" or "12.00-" into minor units of digits digits, using
+// decimal as the decimal separator and taking the other separators for
+// thousands separators. An empty amount is zero. Amounts finer than the
+// minor unit are an error rather than rounded, as are letters and other
+// characters that are neither digits, separators nor currency symbols.
+func Parse(s string, decimal rune, digits int) (Amount, error) {
+	var whole, fraction strings.Builder
+	negative := false
+	inFraction := false
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9':
+			if inFraction {
+				fraction.WriteRune(r)
+			} else {
+				whole.WriteRune(r)
+			}
+		case r == decimal:
+			if inFraction {
+				return 0, fmt.Errorf("Bad amount %q", s)
+			}
+			inFraction = true
+		case r == '-' || r == '(':
+			negative = true
+		case r == '.' || r == ',' || r == ' ' || r == '\'' || r == ')' || r == '+' || r == '\u00a0' || r == '\u202f':
+			// thousands separators and decorations
+		case unicode.Is(unicode.Sc, r):
+			// currency symbols
+		default:
+			return 0, fmt.Errorf("Bad amount %q", s)
+		}
+	}
+	if whole.Len() == 0 && fraction.Len() == 0 {
+		return 0, nil
+	}
+
+	f := strings.TrimRight(fraction.String(), "0")
+	if len(f) > digits {
+		return 0, fmt.Errorf("Bad amount %q, finer than %v digits", s, digits)
+	}
+	f += strings.Repeat("0", digits-len(f))
+	w := whole.String()
+	if w == "" {
+		w = "0"
+	}
+	v, err := strconv.ParseInt(w+f, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Bad amount %q", s)
+	}
+	if negative {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// FromFloat rounds f to the nearest minor unit of digits digits.
+func FromFloat(f float64, digits int) Amount {
+	return Amount(math.Round(f * float64(pow10(digits))))
+}
+
+// Float returns a as a number of major units.
+func (a Amount) Float(digits int) float64 {
+	return float64(a) / float64(pow10(digits))
+}
+
+// Mul multiplies a by f, rounding to the nearest minor unit.
+func (a Amount) Mul(f float64) Amount {
+	return Amount(math.Round(float64(a) * f))
+}
+
+// Convert turns a, in minor units of from digits, into minor units of to
+// digits at rate units of the new currency for one of the old.
+func (a Amount) Convert(rate float64, from int, to int) Amount {
+	return FromFloat(a.Float(from)*rate, to)
+}
+
+// Rescale turns a, in minor units of from digits, into minor units of to
+// digits, rounding half away from zero when there are fewer of them.
+func (a Amount) Rescale(from int, to int) Amount {
+	if to >= from {
+		return a * Amount(pow10(to-from))
+	}
+	p := Amount(pow10(from - to))
+	if a < 0 {
+		return (a - p/2) / p
+	}
+	return (a + p/2) / p
+}
+
+// Format writes a with all digits of its minor unit, as in "-1234.50".
+func (a Amount) Format(digits int) string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	if digits == 0 {
+		return sign + strconv.FormatInt(v, 10)
+	}
+	p := pow10(digits)
+	return fmt.Sprintf("%v%d.%0*d", sign, v/p, digits, v%p)
+}
+
+// Text writes a like Format without the trailing zeros of the fraction, as
+// in "-1234.5", and zero as the empty string.
+func (a Amount) Text(digits int) string {
+	if a == 0 {
+		return ""
+	}
+	s := a.Format(digits)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package money
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in      string
+		decimal rune
+		digits  int
+		want    Amount
+	}{
+		{"1,234.56", '.', 2, 123456},
+		{"1.234,56", ',', 2, 123456},
+		{"1 234 567,8", ',', 2, 123456780},
+		{"1'234.5", '.', 2, 123450},
+		{"-12.00", '.', 2, -1200},
+		{"(12.00)", '.', 2, -1200},
+		{"12.00-", '.', 2, -1200},
+		{"$ 3.5", '.', 2, 350},
+		{"€0,07", ',', 2, 7},
+		{"1,500", '.', 0, 1500},
+		{"1.5", '.', 4, 15000},
+		{"", '.', 2, 0},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.in, c.decimal, c.digits)
+		if err != nil || got != c.want {
+			t.Errorf("Parse(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+
+	for _, bad := range []string{"1.234", "1.2.3", "12abc", "abc", "12 USD", "1?2"} {
+		if got, err := Parse(bad, '.', 2); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", bad, got)
+		}
+	}
+}
+
+func TestSumIsExact(t *testing.T) {
+	var sum Amount
+	var fsum float64
+	for i := 0; i < 10000; i++ {
+		sum += FromFloat(0.1, 2)
+		fsum += 0.1
+	}
+	if sum.Format(2) != "1000.00" {
+		t.Errorf("Sum = %v, want 1000.00", sum.Format(2))
+	}
+	if fsum == 1000 {
+		t.Errorf("Expected the float sum to drift")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		a      Amount
+		digits int
+		format string
+		text   string
+	}{
+		{123450, 2, "1234.50", "1234.5"},
+		{-5, 2, "-0.05", "-0.05"},
+		{1500, 0, "1500", "1500"},
+		{12345, 3, "12.345", "12.345"},
+		{0, 2, "0.00", ""},
+	}
+	for _, c := range cases {
+		if got := c.a.Format(c.digits); got != c.format {
+			t.Errorf("Format(%v, %v) = %q, want %q", int64(c.a), c.digits, got, c.format)
+		}
+		if got := c.a.Text(c.digits); got != c.text {
+			t.Errorf("Text(%v, %v) = %q, want %q", int64(c.a), c.digits, got, c.text)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	if got := Amount(1000).Convert(110.5, 2, 0); got != 1105 {
+		t.Errorf("Convert = %v, want 1105", got)
+	}
+	if got := Amount(1105).Rescale(0, 2); got != 110500 {
+		t.Errorf("Rescale up = %v, want 110500", got)
+	}
+	if got := Amount(-12345).Rescale(3, 2); got != -1235 {
+		t.Errorf("Rescale down = %v, want -1235", got)
+	}
+	if got := Digits("jpy"); got != 0 {
+		t.Errorf("Digits(jpy) = %v, want 0", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []struct {
+		currency string
+		in       string
+		minor    Amount
+	}{
+		{"JPY", "1,500", 1500},
+		{"JPY", "-7", -7},
+		{"BHD", "1.234", 1234},
+		{"BHD", "-0.005", -5},
+		{"USD", "20.50", 2050},
+	}
+	for _, c := range cases {
+		digits := Digits(c.currency)
+		a, err := Parse(c.in, '.', digits)
+		if err != nil || a != c.minor {
+			t.Errorf("Parse(%q) in %v = %v, %v, want %v", c.in, c.currency, a, err, c.minor)
+			continue
+		}
+		// Through the digits amounts are loaded with and back.
+		loaded := a.Rescale(digits, MaxDigits)
+		if back := loaded.Rescale(MaxDigits, digits); back != a {
+			t.Errorf("%v %v came back as %v", c.currency, a, back)
+		}
+		again, err := Parse(a.Format(digits), '.', digits)
+		if err != nil || again != a {
+			t.Errorf("Parse(Format(%v)) in %v = %v, %v", a, c.currency, again, err)
+		}
+	}
+	if _, err := Parse("1500.5", '.', Digits("JPY")); err == nil {
+		t.Errorf("Expected half a yen to fail")
+	}
+	if _, err := Parse("1.2345", '.', Digits("BHD")); err == nil {
+		t.Errorf("Expected a tenth of a fils to fail")
+	}
+}
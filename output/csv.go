@@ -14,6 +14,9 @@ type CSVOutputOptions struct {
 	Separator  rune
 	WriteTo    io.Writer
 	TimeFormat string
+	// OmitTypes leaves the row of column types out of the header, for
+	// files not meant to be loaded back.
+	OmitTypes bool
 }
 
 func NewCSVOutput(opts *CSVOutputOptions) *CSVOutput {
@@ -27,12 +30,14 @@ func NewCSVOutput(opts *CSVOutputOptions) *CSVOutput {
 }
 
 func (csvOutput *CSVOutput) WriteHeader(types []string, columns []string) error {
-	err := csvOutput.writer.Write(types)
-	if err != nil {
-		return err
+	if !csvOutput.Options.OmitTypes {
+		err := csvOutput.writer.Write(types)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = csvOutput.writer.Write(columns)
+	err := csvOutput.writer.Write(columns)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,26 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSVOutputWritesTypes(t *testing.T) {
+	cases := []struct {
+		omitTypes bool
+		expected  string
+	}{
+		{false, "TEXT,REAL\ncategory,amount\nfood,12.50\n"},
+		{true, "category,amount\nfood,12.50\n"},
+	}
+	for _, c := range cases {
+		var b bytes.Buffer
+		out := NewCSVOutput(&CSVOutputOptions{Separator: ',', WriteTo: &b, OmitTypes: c.omitTypes})
+		out.WriteHeader([]string{"TEXT", "REAL"}, []string{"category", "amount"})
+		out.WriteRow([]string{"food", "12.50"})
+		out.Flush()
+		if b.String() != c.expected {
+			t.Errorf("OmitTypes %v: expected %q, got %q", c.omitTypes, c.expected, b.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONOutput writes rows as a JSON array of objects keyed by column, the
+// REAL and INTEGER columns as numbers.
+type JSONOutput struct {
+	Options *JSONOutputOptions
+	types   []string
+	columns []string
+	rows    []map[string]interface{}
+}
+
+type JSONOutputOptions struct {
+	WriteTo io.Writer
+	// Indent, if set, puts every value on its own line indented by it.
+	Indent string
+}
+
+func NewJSONOutput(opts *JSONOutputOptions) *JSONOutput {
+	return &JSONOutput{Options: opts, rows: []map[string]interface{}{}}
+}
+
+func (jsonOutput *JSONOutput) WriteHeader(types []string, columns []string) error {
+	jsonOutput.types = types
+	jsonOutput.columns = columns
+	return nil
+}
+
+func (jsonOutput *JSONOutput) WriteRow(values []string) error {
+	row := make(map[string]interface{})
+	for i, column := range jsonOutput.columns {
+		if i >= len(values) {
+			break
+		}
+		switch jsonOutput.types[i] {
+		case "REAL", "INTEGER":
+			if values[i] == "" {
+				row[column] = nil
+			} else {
+				row[column] = json.Number(values[i])
+			}
+		default:
+			row[column] = values[i]
+		}
+	}
+	jsonOutput.rows = append(jsonOutput.rows, row)
+	return nil
+}
+
+// Flush writes the rows so far, JSON being written as a whole.
+func (jsonOutput *JSONOutput) Flush() error {
+	encoder := json.NewEncoder(jsonOutput.Options.WriteTo)
+	encoder.SetIndent("", jsonOutput.Options.Indent)
+	err := encoder.Encode(jsonOutput.rows)
+	jsonOutput.rows = []map[string]interface{}{}
+	return err
+}
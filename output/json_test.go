@@ -0,0 +1,34 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestJSONOutputWritesRows(t *testing.T) {
+	var buf bytes.Buffer
+	jsonOutput := NewJSONOutput(&JSONOutputOptions{WriteTo: &buf})
+	jsonOutput.WriteHeader([]string{"TEXT", "REAL", "INTEGER"}, []string{"category", "amount", "count"})
+	jsonOutput.WriteRow([]string{"grocery", "20.50", "2"})
+	jsonOutput.WriteRow([]string{"rent", "", "1"})
+	err := jsonOutput.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"amount":20.50,"category":"grocery","count":2},{"amount":null,"category":"rent","count":1}]` + "\n"
+	if buf.String() != expected {
+		t.Errorf("JSONOutput wrote %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestJSONOutputWritesEmptyArray(t *testing.T) {
+	var buf bytes.Buffer
+	jsonOutput := NewJSONOutput(&JSONOutputOptions{WriteTo: &buf})
+	jsonOutput.WriteHeader([]string{"TEXT"}, []string{"category"})
+	jsonOutput.Flush()
+
+	if buf.String() != "[]\n" {
+		t.Errorf("JSONOutput wrote %q, want %q", buf.String(), "[]\n")
+	}
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"../money"
+)
+
+// QIFTimeFormat is the date layout QIFOutput writes.
+const QIFTimeFormat = "01/02/2006"
+
+type QIFOutput struct {
+	Options *QIFOutputOptions
+	writer  *bufio.Writer
+}
+
+type QIFOutputOptions struct {
+	// Type is the account type of the block, "Bank" or "CCard".
+	Type    string
+	WriteTo io.Writer
+}
+
+// QIFTransaction is one transaction of a QIF file. Amount is signed from
+// the account's point of view, so money going out is negative, in minor
+// units of Digits digits.
+type QIFTransaction struct {
+	Date     time.Time
+	Amount   money.Amount
+	Digits   int
+	Payee    string
+	Category string
+	Memo     string
+	// Splits are the parts of a split transaction, in the same minor
+	// units as Amount.
+	Splits []QIFSplit
+}
+
+// QIFSplit is one part of a split QIFTransaction.
+type QIFSplit struct {
+	Category string
+	Memo     string
+	Amount   money.Amount
+}
+
+func NewQIFOutput(opts *QIFOutputOptions) *QIFOutput {
+	if opts.Type == "" {
+		opts.Type = "Bank"
+	}
+	return &QIFOutput{
+		Options: opts,
+		writer:  bufio.NewWriter(opts.WriteTo),
+	}
+}
+
+func (qifOutput *QIFOutput) WriteHeader() error {
+	_, err := fmt.Fprintf(qifOutput.writer, "!Type:%v\n", qifOutput.Options.Type)
+	return err
+}
+
+func (qifOutput *QIFOutput) WriteTransaction(t QIFTransaction) error {
+	fmt.Fprintf(qifOutput.writer, "D%v\n", t.Date.Format(QIFTimeFormat))
+	fmt.Fprintf(qifOutput.writer, "T%v\n", t.Amount.Format(t.Digits))
+	if t.Payee != "" {
+		fmt.Fprintf(qifOutput.writer, "P%v\n", t.Payee)
+	}
+	if t.Category != "" {
+		fmt.Fprintf(qifOutput.writer, "L%v\n", t.Category)
+	}
+	if t.Memo != "" {
+		fmt.Fprintf(qifOutput.writer, "M%v\n", t.Memo)
+	}
+	for _, s := range t.Splits {
+		fmt.Fprintf(qifOutput.writer, "S%v\n", s.Category)
+		if s.Memo != "" {
+			fmt.Fprintf(qifOutput.writer, "E%v\n", s.Memo)
+		}
+		fmt.Fprintf(qifOutput.writer, "$%v\n", s.Amount.Format(t.Digits))
+	}
+	_, err := fmt.Fprintln(qifOutput.writer, "^")
+	return err
+}
+
+func (qifOutput *QIFOutput) Flush() error {
+	return qifOutput.writer.Flush()
+}
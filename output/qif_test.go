@@ -0,0 +1,49 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestQIFOutputWritesTransactions(t *testing.T) {
+	var buf bytes.Buffer
+	qifOutput := NewQIFOutput(&QIFOutputOptions{WriteTo: &buf})
+	qifOutput.WriteHeader()
+	qifOutput.WriteTransaction(QIFTransaction{
+		Date:     time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC),
+		Amount:   -2050,
+		Digits:   2,
+		Payee:    "SAFEWAY",
+		Category: "grocery",
+	})
+	qifOutput.Flush()
+
+	expected := "!Type:Bank\nD01/03/2019\nT-20.50\nPSAFEWAY\nLgrocery\n^\n"
+	if buf.String() != expected {
+		t.Errorf("QIFOutput wrote %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestQIFOutputWritesSplits(t *testing.T) {
+	var buf bytes.Buffer
+	qifOutput := NewQIFOutput(&QIFOutputOptions{WriteTo: &buf})
+	qifOutput.WriteHeader()
+	qifOutput.WriteTransaction(QIFTransaction{
+		Date:     time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC),
+		Amount:   -10000,
+		Digits:   2,
+		Payee:    "COSTCO",
+		Category: "Groceries",
+		Splits: []QIFSplit{
+			{Category: "Household", Memo: "towels", Amount: -3000},
+			{Category: "Groceries", Amount: -7000},
+		},
+	})
+	qifOutput.Flush()
+
+	expected := "!Type:Bank\nD01/03/2019\nT-100.00\nPCOSTCO\nLGroceries\nSHousehold\nEtowels\n$-30.00\nSGroceries\n$-70.00\n^\n"
+	if buf.String() != expected {
+		t.Errorf("QIFOutput wrote %q, want %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Override puts one transaction in a category regardless of its mechant.
+type Override struct {
+	ID       string
+	Category string
+}
+
+func (ms *MoneySense) loadOverrides() map[string]string {
+	overrides := make(map[string]string)
+
+	rows, err := ms.store.Query(`SELECT txid, category FROM ms_overrides`)
+	if err != nil {
+		log.Fatal("Failed to query overrides: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o Override
+		err = rows.Scan(&o.ID, &o.Category)
+		if err != nil {
+			log.Fatal(err)
+		}
+		overrides[o.ID] = o.Category
+	}
+	return overrides
+}
+
+// Overrides lists the overrides in the order they were set.
+func (ms *MoneySense) Overrides() ([]Override, error) {
+	var result []Override
+
+	rows, err := ms.store.Query(`SELECT txid, category FROM ms_overrides ORDER BY rowid ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o Override
+		err = rows.Scan(&o.ID, &o.Category)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, o)
+	}
+	return result, rows.Err()
+}
+
+func (ms *MoneySense) SetOverride(id string, category string) error {
+	var count int
+	query := fmt.Sprintf(`SELECT count(*) FROM "%v" WHERE %v = ?`, ms.history, FingerprintColumn)
+	err := ms.store.QueryRow(query, id).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("No transaction %v", id)
+	}
+	_, err = ms.store.Exec(`INSERT OR REPLACE INTO ms_overrides(txid, category) VALUES(?, ?)`, id, category)
+	ms.warnInMemory()
+	return err
+}
+
+func (ms *MoneySense) ClearOverride(id string) error {
+	result, err := ms.store.Exec(`DELETE FROM ms_overrides WHERE txid = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("No override for %v", id)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"image/color"
 	"log"
 	"math/rand"
@@ -30,7 +29,6 @@ func PlotPieByCategory(data map[string]float64) error {
 	var offset float64
 	// Setup pie chart
 	for category, amount := range data {
-		fmt.Println("Plotting", category, amount)
 		pie, err := piechart.NewPieChart(plotter.Values{amount})
 		if err != nil {
 			log.Fatal("Failed to plot:", err)
@@ -52,10 +50,46 @@ func PlotPieByCategory(data map[string]float64) error {
 	return err
 }
 
-func plotLinePointsHistory(history map[string][]Record) error {
+// plotBalances plots the balances of the accounts, digits holding the
+// digits of the minor unit of each of them.
+func plotBalances(balances map[string][]Balance, digits map[string]int) error {
 	p, err := plot.New()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	p.Title.Text = "Balances"
+	p.X.Tick.Marker = plot.TimeTicks{Format: TimeFormat}
+	p.X.Label.Text = "Date"
+	p.Y.Label.Text = "Balance"
+	p.Add(plotter.NewGrid())
+	p.Legend.Top = true
+
+	for account, bs := range balances {
+		var pts plotter.XYs
+		for _, b := range bs {
+			pts = append(pts, plotter.XY{X: float64(b.Date.Unix()), Y: b.Amount.Float(digits[account])})
+		}
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			return err
+		}
+		line.Color = color.RGBA{
+			R: uint8(rand.Intn(255)),
+			G: uint8(rand.Intn(255)),
+			B: uint8(rand.Intn(255)),
+			A: 255,
+		}
+		p.Add(line)
+		p.Legend.Add(account, line)
+	}
+
+	return p.Save(1000, 600, "./graph/Balances.png")
+}
+
+func plotLinePointsHistory(history map[string][]Record, digits int) error {
+	p, err := plot.New()
+	if err != nil {
+		return err
 	}
 	// xticks defines how we convert and display time.Time values.
 	xticks := plot.TimeTicks{Format: TimeFormat}
@@ -71,13 +105,13 @@ func plotLinePointsHistory(history map[string][]Record) error {
 		for _, r := range records {
 			point := plotter.XY{
 				X: float64(r.Date.Unix()),
-				Y: r.Amount,
+				Y: r.Amount.Float(digits),
 			}
 			pts = append(pts, point)
 		}
 		lpLine, lpPoints, err := plotter.NewLinePoints(pts)
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
 		lpLine.Color = color.RGBA{
 			R: uint8(rand.Intn(255)),
@@ -91,17 +125,12 @@ func plotLinePointsHistory(history map[string][]Record) error {
 		p.Legend.Add(category, lpLine, lpPoints)
 	}
 
-	err = p.Save(1000, 1000, "./graph/plotLinePointsHistory.png")
-	if err != nil {
-		log.Panic(err)
-	}
-	return nil
+	return p.Save(1000, 1000, "./graph/plotLinePointsHistory.png")
 }
 
-func plotBarChartHistory(history map[string][]Record) error {
+func plotBarChartHistory(history map[string][]Record, digits int) error {
 	p, err := plot.New()
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
 	// xticks defines how we convert and display time.Time values.
@@ -119,12 +148,12 @@ func plotBarChartHistory(history map[string][]Record) error {
 		var values plotter.Values
 		xnames = nil
 		for _, r := range records {
-			values = append(values, r.Amount)
+			values = append(values, r.Amount.Float(digits))
 			xnames = append(xnames, r.Date.Format(TimeFormat))
 		}
 		bars, err := plotter.NewBarChart(values, w)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		bars.LineStyle.Width = vg.Length(0)
 		bars.Color = color.RGBA{
@@ -141,9 +170,141 @@ func plotBarChartHistory(history map[string][]Record) error {
 		p.NominalX(xnames...)
 		pBars = bars
 	}
-	err = p.Save(vg.Length(len(xnames))*vg.Inch, 1000, "./graph/plotBarChartHistory.png")
+	return p.Save(vg.Length(len(xnames))*vg.Inch, 1000, "./graph/plotBarChartHistory.png")
+}
+
+// plotForecast plots the actual spending of every forecast as a line with
+// points and the projected one as a dashed line in a confidence band.
+func plotForecast(forecasts []Forecast, digits int) error {
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Spending Forecast"
+	p.X.Tick.Marker = plot.TimeTicks{Format: TimeFormat}
+	p.X.Label.Text = "Month"
+	p.Y.Label.Text = "Amount"
+	p.Add(plotter.NewGrid())
+	p.Legend.Top = true
+
+	for _, f := range forecasts {
+		c := color.RGBA{
+			R: uint8(rand.Intn(255)),
+			G: uint8(rand.Intn(255)),
+			B: uint8(rand.Intn(255)),
+			A: 255,
+		}
+		var actual, projected, low, high plotter.XYs
+		for i, m := range f.Months {
+			x := float64(m.Start.Unix())
+			if i <= f.Past {
+				actual = append(actual, plotter.XY{X: x, Y: m.Actual.Float(digits)})
+			}
+			if i >= f.Past {
+				projected = append(projected, plotter.XY{X: x, Y: m.Projected.Float(digits)})
+				low = append(low, plotter.XY{X: x, Y: m.Low.Float(digits)})
+				high = append(high, plotter.XY{X: x, Y: m.High.Float(digits)})
+			}
+		}
+		// The band goes along the highs and back along the lows.
+		band := append(plotter.XYs(nil), high...)
+		for i := len(low) - 1; i >= 0; i-- {
+			band = append(band, low[i])
+		}
+		polygon, err := plotter.NewPolygon(band)
+		if err != nil {
+			return err
+		}
+		polygon.Color = color.RGBA{R: c.R, G: c.G, B: c.B, A: 48}
+		polygon.LineStyle.Width = 0
+		p.Add(polygon)
+
+		lpLine, lpPoints, err := plotter.NewLinePoints(actual)
+		if err != nil {
+			return err
+		}
+		lpLine.Color = c
+		lpPoints.Shape = draw.CrossGlyph{}
+		lpPoints.Color = c
+		p.Add(lpLine, lpPoints)
+		p.Legend.Add(f.Category, lpLine, lpPoints)
+
+		line, err := plotter.NewLine(projected)
+		if err != nil {
+			return err
+		}
+		line.Color = c
+		line.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+		p.Add(line)
+	}
+
+	return p.Save(1000, 1000, "./graph/Forecast.png")
+}
+
+// plotGoals plots what was saved for every goal by month, with a dashed
+// line from there to the target at the projected completion date.
+func plotGoals(progress []GoalProgress, digits func(g Goal) int) error {
+	p, err := plot.New()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	p.Title.Text = "Savings Goals"
+	p.X.Tick.Marker = plot.TimeTicks{Format: TimeFormat}
+	p.X.Label.Text = "Date"
+	p.Y.Label.Text = "Saved"
+	p.Add(plotter.NewGrid())
+	p.Legend.Top = true
+
+	for _, g := range progress {
+		if len(g.History) == 0 {
+			continue
+		}
+		d := digits(g.Goal)
+		c := color.RGBA{
+			R: uint8(rand.Intn(255)),
+			G: uint8(rand.Intn(255)),
+			B: uint8(rand.Intn(255)),
+			A: 255,
+		}
+		var pts plotter.XYs
+		for _, b := range g.History {
+			pts = append(pts, plotter.XY{X: float64(b.Date.Unix()), Y: b.Amount.Float(d)})
+		}
+		lpLine, lpPoints, err := plotter.NewLinePoints(pts)
+		if err != nil {
+			return err
+		}
+		lpLine.Color = c
+		lpPoints.Shape = draw.CrossGlyph{}
+		lpPoints.Color = c
+		p.Add(lpLine, lpPoints)
+		p.Legend.Add(g.Name, lpLine, lpPoints)
+
+		// The target from the start to the deadline.
+		target, err := plotter.NewLine(plotter.XYs{
+			{X: pts[0].X, Y: g.Target.Float(d)},
+			{X: float64(g.Deadline.Unix()), Y: g.Target.Float(d)},
+		})
+		if err != nil {
+			return err
+		}
+		target.Color = c
+		target.Dashes = []vg.Length{vg.Points(2), vg.Points(2)}
+		p.Add(target)
+
+		if !g.Completion.IsZero() && g.Completion.After(g.Date) {
+			projection, err := plotter.NewLine(plotter.XYs{
+				pts[len(pts)-1],
+				{X: float64(g.Completion.Unix()), Y: g.Target.Float(d)},
+			})
+			if err != nil {
+				return err
+			}
+			projection.Color = c
+			projection.Dashes = []vg.Length{vg.Points(6), vg.Points(4)}
+			p.Add(projection)
+		}
 	}
-	return nil
+
+	return p.Save(1000, 600, "./graph/Goals.png")
 }
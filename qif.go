@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"./money"
+	"./output"
+)
+
+// ExportQIF writes the history between start and end, with the categories
+// it is reported under, to fileName as a QIF bank account.
+func (ms *MoneySense) ExportQIF(fileName string, start string, end string) error {
+	start_dt, err := time.Parse(TimeFormat, start)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", start)
+	}
+	end_dt, err := time.Parse(TimeFormat, end)
+	if err != nil {
+		return fmt.Errorf("Failed to parse date: %v", end)
+	}
+
+	c, err := ms.newCategorizer()
+	if err != nil {
+		return err
+	}
+	splits := ms.loadSplits()
+
+	memo := "''"
+	if ms.store.HasColumn(ms.history, "memo") {
+		memo = "IFNULL(memo, '')"
+	}
+	rates := ms.loadRates()
+	currencies := ms.accountCurrencies()
+	query := fmt.Sprintf(`SELECT IFNULL(%v, ''), IFNULL(%v, '%v'), date, mechant, %v, IFNULL(%v, ''), %v, %v FROM %v
+		WHERE date >= '%v' AND date <= '%v' AND %v ORDER BY date ASC`,
+		FingerprintColumn, AccountColumn, DefaultAccount, signedAmount, CurrencyColumn, memo, ms.importedCategory(), ms.history, start_dt, end_dt, ms.accountCondition(""))
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		log.Fatal("query data base failed!: ", err)
+	}
+	defer rows.Close()
+
+	writer, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	qifOutput := output.NewQIFOutput(&output.QIFOutputOptions{
+		Type:    "Bank",
+		WriteTo: writer,
+	})
+	qifOutput.WriteHeader()
+	var count int
+	for rows.Next() {
+		var t Transaction
+		var amount money.Amount
+		var memo string
+		err = rows.Scan(&t.ID, &t.Account, &t.Date, &t.Mechant, &amount, &t.Currency, &memo, &t.ImportedCategory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// QIF files hold the amounts in their own currency, a missing
+		// exchange rate does not matter.
+		err = ms.setAmount(&t, amount, rates, currencies)
+		if err != nil && err != errNoRate {
+			return err
+		}
+		c.categorize(&t)
+		digits := money.Digits(t.Currency)
+		qt := output.QIFTransaction{
+			Date:     t.Date,
+			Amount:   -t.Original,
+			Digits:   digits,
+			Payee:    t.Mechant,
+			Category: t.Category,
+			Memo:     memo,
+		}
+		// Split transactions list every part, the rest under the category
+		// of the transaction.
+		if parts := splits[t.ID]; len(parts) > 0 {
+			for _, r := range splitRecords(t.Date, t.Original, digits, t.Category, parts) {
+				qt.Splits = append(qt.Splits, output.QIFSplit{Category: r.Category, Amount: -r.Amount})
+			}
+		}
+		err = qifOutput.WriteTransaction(qt)
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	fmt.Printf("Exported %v transactions to %v\n", count, fileName)
+	return qifOutput.Flush()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"./money"
+)
+
+// cadence is a regular interval charges recur at. Charges count as on
+// time when they come between min and max days after the one before.
+type cadence struct {
+	Name    string
+	Days    int
+	Min     int
+	Max     int
+	PerYear int
+	// Charges is how many charges it takes to recognize the cadence.
+	Charges int
+}
+
+var cadences = []cadence{
+	{Name: "weekly", Days: 7, Min: 5, Max: 9, PerYear: 52, Charges: 3},
+	{Name: "monthly", Days: 30, Min: 26, Max: 35, PerYear: 12, Charges: 3},
+	{Name: "yearly", Days: 365, Min: 350, Max: 380, PerYear: 1, Charges: 2},
+}
+
+// next returns when the charge after the one on date is expected.
+func (c cadence) next(date time.Time) time.Time {
+	switch c.PerYear {
+	case 12:
+		return date.AddDate(0, 1, 0)
+	case 1:
+		return date.AddDate(1, 0, 0)
+	}
+	return date.AddDate(0, 0, c.Days)
+}
+
+// recurringSpread is how far, as a fraction of their median, the amounts
+// of a mechant may be apart for its charges to count as recurring.
+const recurringSpread = 0.25
+
+// Subscription is a mechant charging at a regular cadence. Amount is the
+// last charge and Previous the one before it, in the base currency.
+type Subscription struct {
+	Mechant  string
+	Category string
+	Cadence  string
+	Charges  int
+	First    time.Time
+	Last     time.Time
+	Amount   money.Amount
+	Previous money.Amount
+	// Next is when the next charge is expected.
+	Next time.Time
+	// Late is set when the last charge came later than the cadence
+	// allows, Missed when the next one is overdue.
+	Late   bool
+	Missed bool
+
+	cadence cadence
+}
+
+// Annual is what the subscription costs in a year at its last price.
+func (s Subscription) Annual() money.Amount {
+	return s.Amount * money.Amount(s.cadence.PerYear)
+}
+
+// PriceIncrease tells whether the last charge cost more than the one
+// before it.
+func (s Subscription) PriceIncrease() bool {
+	return s.Amount > s.Previous
+}
+
+// recurringKey groups the mechant names of one payee, leaving out the
+// words holding digits such as store numbers and references.
+func recurringKey(mechant string) string {
+	var words []string
+	for _, w := range strings.Fields(strings.ToUpper(mechant)) {
+		if strings.IndexFunc(w, unicode.IsDigit) < 0 {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return strings.ToUpper(strings.TrimSpace(mechant))
+	}
+	return strings.Join(words, " ")
+}
+
+// Subscriptions finds the mechants that charged at a regular cadence with
+// stable amounts up to date, the most expensive in a year first. Refunds
+// and transfers between our accounts are left out.
+func (ms *MoneySense) Subscriptions(date time.Time) ([]Subscription, error) {
+	var result []Subscription
+
+	start := ms.firstDate(date)
+	transactions, err := ms.Transactions(start.Format(TimeFormat), date.Format(TimeFormat), "")
+	if err != nil {
+		return nil, err
+	}
+	transfers := ms.transferIDs()
+
+	var keys []string
+	charges := make(map[string][]Transaction)
+	for _, t := range transactions {
+		if t.Amount <= 0 || transfers[t.ID] {
+			continue
+		}
+		key := recurringKey(t.Mechant)
+		if _, ok := charges[key]; !ok {
+			keys = append(keys, key)
+		}
+		charges[key] = append(charges[key], t)
+	}
+
+	for _, key := range keys {
+		if s, ok := findSubscription(key, charges[key], date); ok {
+			result = append(result, s)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Annual() > result[j].Annual()
+	})
+	return result, nil
+}
+
+// findSubscription tells whether the charges of mechant, oldest first,
+// recur at one of the cadences, and how the subscription stands on date.
+func findSubscription(mechant string, charges []Transaction, date time.Time) (Subscription, bool) {
+	if len(charges) < 2 {
+		return Subscription{}, false
+	}
+
+	var intervals []int
+	amounts := make([]money.Amount, len(charges))
+	for i, t := range charges {
+		amounts[i] = t.Amount
+		if i > 0 {
+			intervals = append(intervals, int(t.Date.Sub(charges[i-1].Date).Hours()/24+0.5))
+		}
+	}
+	median := medianInt(intervals)
+
+	for _, c := range cadences {
+		if len(charges) < c.Charges || median < c.Min || median > c.Max {
+			continue
+		}
+		// Allow one gap off the cadence, a late or a missed charge.
+		off := 0
+		for _, d := range intervals {
+			if d < c.Min || d > c.Max {
+				off++
+			}
+		}
+		if off > 1 || !stableAmounts(amounts) {
+			return Subscription{}, false
+		}
+
+		last := charges[len(charges)-1]
+		s := Subscription{
+			Mechant:  mechant,
+			Category: last.Category,
+			Cadence:  c.Name,
+			Charges:  len(charges),
+			First:    charges[0].Date,
+			Last:     last.Date,
+			Amount:   last.Amount,
+			Previous: charges[len(charges)-2].Amount,
+			Next:     c.next(last.Date),
+			Late:     intervals[len(intervals)-1] > c.Max,
+			cadence:  c,
+		}
+		s.Missed = date.After(s.Next.AddDate(0, 0, c.Max-c.Days))
+		return s, true
+	}
+	return Subscription{}, false
+}
+
+// stableAmounts tells whether amounts are all within recurringSpread of
+// their median.
+func stableAmounts(amounts []money.Amount) bool {
+	sorted := append([]money.Amount(nil), amounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	spread := median.Mul(recurringSpread)
+	return sorted[0] >= median-spread && sorted[len(sorted)-1] <= median+spread
+}
+
+func medianInt(values []int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
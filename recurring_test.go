@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestRecurringKey(t *testing.T) {
+	cases := []struct {
+		mechant  string
+		expected string
+	}{
+		{"NETFLIX.COM", "NETFLIX.COM"},
+		{"Spotify P0A1B2C3 Stockholm", "SPOTIFY STOCKHOLM"},
+		{"SHELL OIL 5522", "SHELL OIL"},
+		{" 1234 ", "1234"},
+	}
+	for _, c := range cases {
+		if key := recurringKey(c.mechant); key != c.expected {
+			t.Errorf("recurringKey(%q) = %q, expected %q", c.mechant, key, c.expected)
+		}
+	}
+}
+
+func TestFindSubscription(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2019, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	charges := func(amount money.Amount, dates ...time.Time) []Transaction {
+		var result []Transaction
+		for _, d := range dates {
+			result = append(result, Transaction{Date: d, Amount: amount, Category: "streaming"})
+		}
+		return result
+	}
+	increased := charges(1399, day(1, 3), day(2, 3), day(3, 3))
+	increased[2].Amount = 1599
+	unstable := charges(1599, day(1, 3), day(2, 3), day(3, 3))
+	unstable[1].Amount = 5000
+
+	cases := []struct {
+		name     string
+		charges  []Transaction
+		date     time.Time
+		ok       bool
+		cadence  string
+		next     time.Time
+		late     bool
+		missed   bool
+		increase bool
+	}{
+		{"monthly", charges(1599, day(1, 3), day(2, 3), day(3, 3)), day(3, 10), true, "monthly", day(4, 3), false, false, false},
+		{"weekly", charges(500, day(1, 1), day(1, 8), day(1, 15), day(1, 22)), day(1, 25), true, "weekly", day(1, 29), false, false, false},
+		{"yearly", charges(9900, day(1, 15), time.Date(2020, 1, 14, 0, 0, 0, 0, time.UTC)), day(12, 1), true, "yearly", time.Date(2021, 1, 14, 0, 0, 0, 0, time.UTC), false, false, false},
+		{"unstable amounts", unstable, day(3, 10), false, "", time.Time{}, false, false, false},
+		{"two monthly charges", charges(1599, day(1, 3), day(2, 3)), day(2, 10), false, "", time.Time{}, false, false, false},
+		{"irregular", charges(1599, day(1, 3), day(1, 20), day(3, 1)), day(3, 10), false, "", time.Time{}, false, false, false},
+		{"two gaps off", charges(1599, day(1, 3), day(2, 3), day(3, 20), day(4, 20), day(6, 1)), day(6, 2), false, "", time.Time{}, false, false, false},
+		{"late", charges(1599, day(1, 3), day(2, 3), day(3, 3), day(4, 20)), day(4, 21), true, "monthly", day(5, 20), true, false, false},
+		// Monthly charges are missed 5 days after they were due.
+		{"due", charges(1599, day(1, 3), day(2, 3), day(3, 3)), day(4, 8), true, "monthly", day(4, 3), false, false, false},
+		{"missed", charges(1599, day(1, 3), day(2, 3), day(3, 3)), day(4, 9), true, "monthly", day(4, 3), false, true, false},
+		{"price increase", increased, day(3, 10), true, "monthly", day(4, 3), false, false, true},
+	}
+	for _, c := range cases {
+		s, ok := findSubscription("NETFLIX", c.charges, c.date)
+		if ok != c.ok {
+			t.Errorf("%v: expected found %v, got %v", c.name, c.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if s.Cadence != c.cadence || !s.Next.Equal(c.next) || s.Late != c.late || s.Missed != c.missed || s.PriceIncrease() != c.increase {
+			t.Errorf("%v: unexpected %+v", c.name, s)
+		}
+		if s.Charges != len(c.charges) || s.Category != "streaming" {
+			t.Errorf("%v: unexpected %+v", c.name, s)
+		}
+	}
+}
+
+func TestSubscriptionAnnual(t *testing.T) {
+	cases := []struct {
+		cadence  cadence
+		expected money.Amount
+	}{
+		{cadences[0], 52000},
+		{cadences[1], 12000},
+		{cadences[2], 1000},
+	}
+	for _, c := range cases {
+		s := Subscription{Amount: 1000, cadence: c.cadence}
+		if s.Annual() != c.expected {
+			t.Errorf("%v: expected %v a year, got %v", c.cadence.Name, c.expected, s.Annual())
+		}
+	}
+}
+
+func TestStableAmounts(t *testing.T) {
+	cases := []struct {
+		amounts  []money.Amount
+		expected bool
+	}{
+		{[]money.Amount{1000}, true},
+		{[]money.Amount{1000, 1250, 750}, true},
+		{[]money.Amount{1000, 1251, 1000}, false},
+		{[]money.Amount{1000, 1000, 749}, false},
+	}
+	for _, c := range cases {
+		if stableAmounts(c.amounts) != c.expected {
+			t.Errorf("stableAmounts(%v) should be %v", c.amounts, c.expected)
+		}
+	}
+}
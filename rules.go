@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How the mechant column of a classifier rule is matched.
+const (
+	MatchExact     = "exact"
+	MatchPrefix    = "prefix"
+	MatchSubstring = "substring"
+	MatchGlob      = "glob"
+	MatchRegexp    = "regexp"
+)
+
+// matchOrder breaks priority ties, more specific matches go first.
+var matchOrder = map[string]int{
+	MatchExact:     0,
+	MatchPrefix:    1,
+	MatchSubstring: 2,
+	MatchGlob:      3,
+	MatchRegexp:    4,
+}
+
+// ruleColumns are the classifier columns beyond mechant and category. Rows
+// without them are exact matches, as in classifiers of older versions.
+var ruleColumns = []string{"match", "priority", "min", "max", "since", "until"}
+var ruleTypes = []string{"TEXT", "INTEGER", "REAL", "REAL", "TIMESTAMP", "TIMESTAMP"}
+
+// Rule is one row of the classifier: transactions whose mechant matches
+// Pattern, and whose amount and date are in the optional ranges, belong to
+// Category.
+type Rule struct {
+	Pattern  string
+	Category string
+	Match    string
+	Priority int
+	Min      sql.NullFloat64
+	Max      sql.NullFloat64
+	Since    *time.Time
+	Until    *time.Time
+	re       *regexp.Regexp
+}
+
+type RuleSet []*Rule
+
+func (ms *MoneySense) loadRules() (RuleSet, error) {
+	var rules RuleSet
+
+	query := fmt.Sprintf(`SELECT mechant, category, IFNULL(match, ''), IFNULL(priority, 0), min, max, since, until FROM "%v"`, ms.classifier)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &Rule{}
+		err = rows.Scan(&r.Pattern, &r.Category, &r.Match, &r.Priority, &r.Min, &r.Max, &r.Since, &r.Until)
+		if err != nil {
+			return nil, err
+		}
+		err = r.compile()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	sortRules(rules)
+	return rules, nil
+}
+
+// sortRules puts the rules in the order Find tries them: by priority, then
+// the more specific matches first, then as they were.
+func sortRules(rules RuleSet) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return matchOrder[rules[i].Match] < matchOrder[rules[j].Match]
+	})
+}
+
+func (r *Rule) compile() error {
+	r.Match = strings.ToLower(strings.TrimSpace(r.Match))
+	if r.Match == "" {
+		r.Match = MatchExact
+	}
+	switch r.Match {
+	case MatchExact, MatchPrefix, MatchSubstring:
+	case MatchGlob:
+		if _, err := filepath.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("Bad glob %q: %v", r.Pattern, err)
+		}
+	case MatchRegexp:
+		// Like the other non exact rules it ignores case, unless the
+		// pattern turns that off with (?-i).
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return fmt.Errorf("Bad regexp %q: %v", r.Pattern, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("Unknown match %q for %q", r.Match, r.Pattern)
+	}
+	return nil
+}
+
+// Matches reports whether a transaction falls under the rule. Exact rules
+// compare the mechant as is, the others ignore case.
+func (r *Rule) Matches(mechant string, amount float64, date time.Time) bool {
+	if r.Min.Valid && amount < r.Min.Float64 {
+		return false
+	}
+	if r.Max.Valid && amount > r.Max.Float64 {
+		return false
+	}
+	if r.Since != nil && date.Before(*r.Since) {
+		return false
+	}
+	if r.Until != nil && date.After(*r.Until) {
+		return false
+	}
+
+	upper := strings.ToUpper(mechant)
+	pattern := strings.ToUpper(r.Pattern)
+	switch r.Match {
+	case MatchExact:
+		return mechant == r.Pattern
+	case MatchPrefix:
+		return strings.HasPrefix(upper, pattern)
+	case MatchSubstring:
+		return strings.Contains(upper, pattern)
+	case MatchGlob:
+		ok, _ := filepath.Match(pattern, upper)
+		return ok
+	case MatchRegexp:
+		return r.re.MatchString(mechant)
+	}
+	return false
+}
+
+// Find returns the first rule, by priority, matching the transaction, or
+// nil if there is none.
+func (rs RuleSet) Find(mechant string, amount float64, date time.Time) *Rule {
+	for _, r := range rs {
+		if r.Matches(mechant, amount, date) {
+			return r
+		}
+	}
+	return nil
+}
+
+// hasRule reports whether the classifier table holds the rule already.
+func (ms *MoneySense) hasRule(match string, pattern string, category string, priority int) (bool, error) {
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM "%v" WHERE mechant = ? AND category = ? AND IFNULL(NULLIF(match, ''), ?) = ? AND IFNULL(priority, 0) = ?`, ms.classifier)
+	err := ms.store.QueryRow(query, pattern, category, MatchExact, match, priority).Scan(&count)
+	return count > 0, err
+}
+
+// AddRule inserts a rule into the classifier table.
+func (ms *MoneySense) AddRule(match string, pattern string, category string, priority int) error {
+	r := &Rule{Pattern: pattern, Category: category, Match: match, Priority: priority}
+	err := r.compile()
+	if err != nil {
+		return err
+	}
+	insert := fmt.Sprintf(`INSERT INTO "%v"(mechant, category, match, priority) VALUES(?, ?, ?, ?)`, ms.classifier)
+	_, err = ms.store.Exec(insert, r.Pattern, r.Category, r.Match, r.Priority)
+	return err
+}
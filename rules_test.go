@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestRuleMatches(t *testing.T) {
+	day := func(month time.Month, d int) *time.Time {
+		date := time.Date(2019, month, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	cases := []struct {
+		rule     Rule
+		mechant  string
+		amount   float64
+		date     time.Time
+		expected bool
+	}{
+		{Rule{Pattern: "SAFEWAY"}, "SAFEWAY", 10, *day(1, 5), true},
+		{Rule{Pattern: "SAFEWAY"}, "safeway", 10, *day(1, 5), false},
+		{Rule{Pattern: "SAFEWAY"}, "SAFEWAY #1234", 10, *day(1, 5), false},
+		{Rule{Pattern: "safeway", Match: "prefix"}, "SAFEWAY #1234", 10, *day(1, 5), true},
+		{Rule{Pattern: "#1234", Match: "prefix"}, "SAFEWAY #1234", 10, *day(1, 5), false},
+		{Rule{Pattern: "oil", Match: "substring"}, "SHELL OIL 5522", 40, *day(1, 5), true},
+		{Rule{Pattern: "shell*55??", Match: "glob"}, "SHELL OIL 5522", 40, *day(1, 5), true},
+		{Rule{Pattern: "shell*55?", Match: "glob"}, "SHELL OIL 5522", 40, *day(1, 5), false},
+		{Rule{Pattern: `^AMZN Mktp [A-Z0-9]+$`, Match: "regexp"}, "AMZN Mktp US12AB", 25, *day(1, 5), true},
+		{Rule{Pattern: `^AMZN Mktp [A-Z0-9]+$`, Match: "regexp"}, "amzn mktp us12ab", 25, *day(1, 5), true},
+		{Rule{Pattern: `^AMZN Mktp [A-Z0-9]+$`, Match: "regexp"}, "AMZN Mktp US-12", 25, *day(1, 5), false},
+		{Rule{Pattern: `(?-i)^AMZN Mktp`, Match: "regexp"}, "amzn mktp us12ab", 25, *day(1, 5), false},
+		{Rule{Pattern: "APPLE", Min: sql.NullFloat64{Float64: 100, Valid: true}}, "APPLE", 99.99, *day(1, 5), false},
+		{Rule{Pattern: "APPLE", Min: sql.NullFloat64{Float64: 100, Valid: true}}, "APPLE", 100, *day(1, 5), true},
+		{Rule{Pattern: "APPLE", Max: sql.NullFloat64{Float64: 10, Valid: true}}, "APPLE", 10.01, *day(1, 5), false},
+		{Rule{Pattern: "APPLE", Since: day(2, 1)}, "APPLE", 5, *day(1, 31), false},
+		{Rule{Pattern: "APPLE", Since: day(2, 1)}, "APPLE", 5, *day(2, 1), true},
+		{Rule{Pattern: "APPLE", Until: day(2, 1)}, "APPLE", 5, *day(2, 1), true},
+		{Rule{Pattern: "APPLE", Until: day(2, 1)}, "APPLE", 5, *day(2, 2), false},
+	}
+	for _, c := range cases {
+		r := c.rule
+		err := r.compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Matches(c.mechant, c.amount, c.date) != c.expected {
+			t.Errorf("%v rule %q on %q %v %v: expected %v", r.Match, r.Pattern, c.mechant, c.amount, c.date.Format(TimeFormat), c.expected)
+		}
+	}
+}
+
+func TestRuleCompileErrors(t *testing.T) {
+	for _, r := range []Rule{
+		{Pattern: "[a", Match: "glob"},
+		{Pattern: "(a", Match: "regexp"},
+		{Pattern: "a", Match: "fuzzy"},
+	} {
+		if err := r.compile(); err == nil {
+			t.Errorf("Expected %v rule %q to fail to compile", r.Match, r.Pattern)
+		}
+	}
+}
+
+func TestRuleSetFindByPriority(t *testing.T) {
+	rule := func(pattern string, match string, priority int, category string) *Rule {
+		r := &Rule{Pattern: pattern, Match: match, Priority: priority, Category: category}
+		r.compile()
+		return r
+	}
+	rules := RuleSet{
+		rule("AMAZON", "substring", 0, "shopping"),
+		rule("AMAZON*", "glob", 0, "glob"),
+		rule("AMAZON PRIME", "prefix", 0, "prefix"),
+		rule("AMAZON PRIME", "exact", 0, "streaming"),
+		rule("AMAZON WEB", "substring", 10, "hosting"),
+		rule("AMAZON", "prefix", 0, "first prefix"),
+	}
+	sortRules(rules)
+	cases := []struct {
+		mechant  string
+		expected string
+	}{
+		// Exact rules win ties over prefixes, which win over substrings.
+		{"AMAZON PRIME", "streaming"},
+		{"AMAZON PRIME VIDEO", "prefix"},
+		// A higher priority wins over a more specific match.
+		{"AMAZON WEB SERVICES", "hosting"},
+		// Rules of the same priority and match keep their order.
+		{"AMAZON.COM", "first prefix"},
+		{"MKTP AMAZON", "shopping"},
+		{"SAFEWAY", ""},
+	}
+	for _, c := range cases {
+		var category string
+		if r := rules.Find(c.mechant, 10, time.Now()); r != nil {
+			category = r.Category
+		}
+		if category != c.expected {
+			t.Errorf("Find(%q) = %q, expected %q", c.mechant, category, c.expected)
+		}
+	}
+}
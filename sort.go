@@ -1,10 +1,14 @@
 package main
 
-import "sort"
+import (
+	"sort"
+
+	"./money"
+)
 
 type Pair struct {
 	Key   string
-	Value float64
+	Value money.Amount
 }
 
 type PairList []Pair
@@ -13,7 +17,7 @@ func (p PairList) Len() int           { return len(p) }
 func (p PairList) Less(i, j int) bool { return p[i].Value < p[j].Value }
 func (p PairList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-func sortMapByValue(m map[string]float64) PairList {
+func sortMapByValue(m map[string]money.Amount) PairList {
 	pl := make(PairList, len(m))
 	i := 0
 	for k, v := range m {
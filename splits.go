@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"./input"
+	"./money"
+	"./storage"
+)
+
+// Split is the part of a transaction that belongs to a category other
+// than the one its mechant is classified as. Amount is in the currency of
+// the transaction, to money.MaxDigits digits as splits are kept without
+// it.
+type Split struct {
+	ID       string
+	Category string
+	Amount   money.Amount
+}
+
+func (ms *MoneySense) loadSplits() map[string][]Split {
+	splits := make(map[string][]Split)
+
+	rows, err := ms.store.Query(fmt.Sprintf(`SELECT txid, category, %v FROM ms_splits ORDER BY rowid ASC`, toMaxDigits("amount", "")))
+	if err != nil {
+		log.Fatal("Failed to query splits: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s Split
+		err = rows.Scan(&s.ID, &s.Category, &s.Amount)
+		if err != nil {
+			log.Fatal(err)
+		}
+		splits[s.ID] = append(splits[s.ID], s)
+	}
+	return splits
+}
+
+// splitRecords divides a transaction of amount, in minor units of digits
+// digits, into one Record per split part, the amount not covered by any
+// part stays in category, uncategorized if it is empty.
+func splitRecords(date time.Time, amount money.Amount, digits int, category string, parts []Split) []Record {
+	var result []Record
+	rest := amount
+	for _, p := range parts {
+		part := p.Amount.Rescale(money.MaxDigits, digits)
+		result = append(result, Record{Date: date, Amount: part, Category: p.Category})
+		rest -= part
+	}
+	if rest != 0 {
+		result = append(result, Record{Date: date, Amount: rest, Category: category})
+	}
+	return result
+}
+
+// convertRecords sets Original of the parts of a transaction of original,
+// in its own currency, to their amount and converts it into their share
+// of amount, the transaction in the base currency. The last part gets
+// what rounding leaves over so that the parts add up to amount.
+func convertRecords(records []Record, original money.Amount, amount money.Amount) {
+	rest := amount
+	for i := range records {
+		r := &records[i]
+		r.Original = r.Amount
+		r.Amount = 0
+		if original != 0 {
+			r.Amount = amount.Mul(float64(r.Original) / float64(original))
+		}
+		if i == len(records)-1 {
+			r.Amount = rest
+		}
+		rest -= r.Amount
+	}
+}
+
+// checkSplits makes sure parts can split a transaction of amount: they go
+// the same way as the transaction, out or in, and add up to no more.
+func checkSplits(amount money.Amount, parts []Split) error {
+	var sum money.Amount
+	for _, p := range parts {
+		if amount < 0 && p.Amount >= 0 {
+			return errors.New("Split amounts of money coming in should be negative.")
+		}
+		if amount >= 0 && p.Amount <= 0 {
+			return errors.New("Split amounts should be positive.")
+		}
+		sum += p.Amount
+	}
+	if (amount > 0 && sum > amount) || (amount < 0 && sum < amount) {
+		return fmt.Errorf("Splits add up to %v, more than the %v of the transaction.", sum.Text(money.MaxDigits), amount.Text(money.MaxDigits))
+	}
+	return nil
+}
+
+// SetSplits replaces the splits of transaction id. The parts may not add
+// up to more than the transaction.
+func (ms *MoneySense) SetSplits(id string, parts []Split) error {
+	err := ms.setSplits(id, parts)
+	if err != nil {
+		return err
+	}
+	ms.warnInMemory()
+	return nil
+}
+
+// setSplits is SetSplits for the splits of imported files, which are
+// imported again when they are lost with the database.
+func (ms *MoneySense) setSplits(id string, parts []Split) error {
+	var amount money.Amount
+	var digits int
+	query := fmt.Sprintf(`SELECT %v, IFNULL(%v, %v) FROM "%v" WHERE %v = ?`, signedAmount, storage.DigitsColumn, money.MaxDigits, ms.history, FingerprintColumn)
+	err := ms.store.QueryRow(query, id).Scan(&amount, &digits)
+	if err != nil {
+		return fmt.Errorf("No transaction %v", id)
+	}
+	err = checkSplits(amount, parts)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.Amount.Rescale(money.MaxDigits, digits).Rescale(digits, money.MaxDigits) != p.Amount {
+			return fmt.Errorf("Split amount %v is finer than the currency of the transaction.", p.Amount.Text(money.MaxDigits))
+		}
+	}
+
+	err = ms.ClearSplits(id)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		query = fmt.Sprintf(`INSERT INTO ms_splits(txid, category, amount, %v) VALUES(?, ?, ?, ?)`, storage.DigitsColumn)
+		_, err = ms.store.Exec(query, id, p.Category, p.Amount.Rescale(money.MaxDigits, digits), digits)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importSplits stores the splits of the imported transactions, logging
+// the ones that do not fit their transaction.
+func (ms *MoneySense) importSplits(splits map[string][]Split) {
+	for id, parts := range splits {
+		err := ms.setSplits(id, parts)
+		if err != nil {
+			log.Printf("Skipping the splits of %v: %v\n", id, err)
+		}
+	}
+}
+
+// splitsInput collects the split lines of the rows of a QIF file by the
+// fingerprint dedupInput gives them, as the rows are loaded.
+type splitsInput struct {
+	input.Input
+	qif    *input.QIFInput
+	splits map[string][]Split
+}
+
+func (s *splitsInput) ReadRow() []string {
+	row := s.Input.ReadRow()
+	id := field(row, columnIndex(s.Columns(), FingerprintColumn))
+	for _, split := range s.qif.Splits() {
+		s.splits[id] = append(s.splits[id], Split{ID: id, Category: split.Category, Amount: split.Amount})
+	}
+	return row
+}
+
+func (ms *MoneySense) ClearSplits(id string) error {
+	_, err := ms.store.Exec(`DELETE FROM ms_splits WHERE txid = ?`, id)
+	return err
+}
+
+// parseSplits reads "<category> <amount>" pairs of the split command.
+func parseSplits(args []string) ([]Split, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errors.New("Require pairs of category and amount.")
+	}
+	var parts []Split
+	for i := 0; i < len(args); i += 2 {
+		amount, err := money.Parse(args[i+1], '.', money.MaxDigits)
+		if err != nil {
+			return nil, fmt.Errorf("Bad amount %q", args[i+1])
+		}
+		parts = append(parts, Split{Category: args[i], Amount: amount})
+	}
+	return parts, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestSplitRecords(t *testing.T) {
+	date := time.Date(2019, 1, 5, 0, 0, 0, 0, time.UTC)
+	parts := []Split{{Category: "grocery", Amount: 305000}, {Category: "household", Amount: 120000}}
+	cases := []struct {
+		name     string
+		amount   money.Amount
+		digits   int
+		category string
+		parts    []Split
+		expected []Record
+	}{
+		{"not split", 5000, 2, "shopping", nil, []Record{{Date: date, Amount: 5000, Category: "shopping"}}},
+		{"rest", 5000, 2, "shopping", parts, []Record{
+			{Date: date, Amount: 3050, Category: "grocery"},
+			{Date: date, Amount: 1200, Category: "household"},
+			{Date: date, Amount: 750, Category: "shopping"},
+		}},
+		{"no rest", 4250, 2, "shopping", parts, []Record{
+			{Date: date, Amount: 3050, Category: "grocery"},
+			{Date: date, Amount: 1200, Category: "household"},
+		}},
+		{"uncategorized rest", 5000, 2, "", parts, []Record{
+			{Date: date, Amount: 3050, Category: "grocery"},
+			{Date: date, Amount: 1200, Category: "household"},
+			{Date: date, Amount: 750, Category: ""},
+		}},
+		{"uncategorized", 5000, 2, "", nil, []Record{{Date: date, Amount: 5000, Category: ""}}},
+		{"no minor unit", 50, 0, "shopping", []Split{{Category: "grocery", Amount: 300000}}, []Record{
+			{Date: date, Amount: 30, Category: "grocery"},
+			{Date: date, Amount: 20, Category: "shopping"},
+		}},
+		{"refund", -5000, 2, "shopping", []Split{{Category: "grocery", Amount: -200000}}, []Record{
+			{Date: date, Amount: -2000, Category: "grocery"},
+			{Date: date, Amount: -3000, Category: "shopping"},
+		}},
+	}
+	for _, c := range cases {
+		records := splitRecords(date, c.amount, c.digits, c.category, c.parts)
+		if !reflect.DeepEqual(records, c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, records)
+		}
+	}
+}
+
+func TestConvertRecords(t *testing.T) {
+	cases := []struct {
+		name     string
+		parts    []money.Amount
+		original money.Amount
+		amount   money.Amount
+		expected []money.Amount
+	}{
+		{"same currency", []money.Amount{3050, 1950}, 5000, 5000, []money.Amount{3050, 1950}},
+		// Thirds of 10.00 EUR at 1.1 are 3.67 USD, the last part takes
+		// the cent rounding leaves over.
+		{"rounding", []money.Amount{333, 333, 334}, 1000, 1100, []money.Amount{366, 366, 368}},
+		{"refund", []money.Amount{-500, -500}, -1000, -1234, []money.Amount{-617, -617}},
+		{"zero", []money.Amount{0}, 0, 0, []money.Amount{0}},
+	}
+	for _, c := range cases {
+		var records []Record
+		for _, p := range c.parts {
+			records = append(records, Record{Amount: p})
+		}
+		convertRecords(records, c.original, c.amount)
+		var sum money.Amount
+		for i, r := range records {
+			if r.Original != c.parts[i] || r.Amount != c.expected[i] {
+				t.Errorf("%v: part %v is %v of %v, expected %v of %v", c.name, i, r.Amount, r.Original, c.expected[i], c.parts[i])
+			}
+			sum += r.Amount
+		}
+		if sum != c.amount {
+			t.Errorf("%v: parts add up to %v, expected %v", c.name, sum, c.amount)
+		}
+	}
+}
+
+func TestCheckSplits(t *testing.T) {
+	cases := []struct {
+		amount money.Amount
+		parts  []money.Amount
+		ok     bool
+	}{
+		{500000, []money.Amount{200000, 300000}, true},
+		{500000, []money.Amount{200000, 300001}, false},
+		{500000, []money.Amount{-100000}, false},
+		{500000, []money.Amount{0}, false},
+		// Income and refunds split into negative parts.
+		{-500000, []money.Amount{-200000, -100000}, true},
+		{-500000, []money.Amount{-600000}, false},
+		{-500000, []money.Amount{100000}, false},
+	}
+	for _, c := range cases {
+		var parts []Split
+		for _, p := range c.parts {
+			parts = append(parts, Split{Category: "grocery", Amount: p})
+		}
+		err := checkSplits(c.amount, parts)
+		if (err == nil) != c.ok {
+			t.Errorf("checkSplits(%v, %v) = %v, expected ok %v", c.amount, c.parts, err, c.ok)
+		}
+	}
+}
+
+func TestParseSplits(t *testing.T) {
+	parts, err := parseSplits([]string{"grocery", "30.5", "household", "-12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Split{{Category: "grocery", Amount: 305000}, {Category: "household", Amount: -120000}}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %v, got %v", expected, parts)
+	}
+	for _, args := range [][]string{nil, {"grocery"}, {"grocery", "1.23456"}} {
+		if _, err := parseSplits(args); err == nil {
+			t.Errorf("Expected parseSplits(%v) to fail", args)
+		}
+	}
+}
+
+func TestImportQIFSplits(t *testing.T) {
+	ms := newTestMoneySense(t, map[string]string{
+		"history/card.qif": "!Type:CCard\nD01/05/2019\nT-150.00\nPCOSTCO\nSgrocery\n$-100.00\nShousehold\n$-50.00\n^\nD01/06/2019\nT-20.00\nPSAFEWAY\nLgrocery\n^\n",
+	}, MoneySenseOptions{})
+
+	splits := ms.loadSplits()
+	if len(splits) != 1 {
+		t.Fatalf("Expected the splits of one transaction, got %v", splits)
+	}
+	totals := make(map[string]money.Amount)
+	for _, r := range ms.Flows("01/01/2019", "01/31/2019") {
+		totals[r.Category] += r.Amount
+	}
+	// The COSTCO total is only counted once, in its parts.
+	if len(totals) != 2 || totals["grocery"] != 12000 || totals["household"] != 5000 {
+		t.Errorf("Unexpected totals %v", totals)
+	}
+}
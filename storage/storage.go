@@ -4,14 +4,22 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
 	"strings"
 
 	"../input"
+	"../money"
 	"../output"
 
 	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
+// DigitsColumn is the column of a table holding, for every row, the digits
+// of the minor units of its currency its money columns are in. Rows with
+// none, such as the ones just loaded from a file, are in minor units of
+// money.MaxDigits digits until RescaleAmounts turns them into those.
+const DigitsColumn = "digits"
+
 type Storage struct {
 	db     *sql.DB
 	connID int
@@ -29,8 +37,14 @@ func init() {
 		})
 }
 
-func (s *Storage) open() error {
-	db, err := sql.Open("sqlite3_ms", "file::memory:?cache=shared")
+func (s *Storage) open(dbPath string) error {
+	dsn := "file::memory:?cache=shared"
+	if dbPath != "" {
+		// The path is escaped so ? and # in it are not read as the
+		// query or fragment of the URI.
+		dsn = (&url.URL{Scheme: "file", Opaque: url.PathEscape(dbPath), RawQuery: "cache=shared"}).String()
+	}
+	db, err := sql.Open("sqlite3_ms", dsn)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -43,13 +57,20 @@ func (s *Storage) open() error {
 
 	s.connID = len(sqlite3conn) - 1
 	s.db = db
-	return err
+
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS ms_imports (path TEXT PRIMARY KEY, hash TEXT, tablename TEXT, firstrow INTEGER, lastrow INTEGER)`)
+	if err != nil {
+		return err
+	}
+	return s.EnsureColumns("ms_imports", []string{"firstrow", "lastrow"}, []string{"INTEGER", "INTEGER"})
 }
 
-func NewStorage() *Storage {
+// NewStorage opens the SQLite database at dbPath. An empty dbPath keeps
+// everything in a shared in-memory database that is lost on exit.
+func NewStorage(dbPath string) *Storage {
 	storage := Storage{}
 
-	err := storage.open()
+	err := storage.open(dbPath)
 	if err != nil {
 		log.Fatal("Failed to initialize storage")
 	}
@@ -60,26 +81,38 @@ func (s *Storage) Close() error {
 	return s.db.Close()
 }
 
-func (s *Storage) Load(tableName string, input *input.CSVInput) error {
+func (s *Storage) Load(tableName string, input input.Input) error {
 	err := s.createTable(tableName, input.Columns(), input.Types())
 	if err != nil {
 		log.Fatal("Failed to create table!")
 	}
 
+	err = s.EnsureColumns(tableName, input.Columns(), input.Types())
+	if err != nil {
+		log.Fatal("Failed to add columns to table!", err)
+	}
+
 	tx, txErr := s.db.Begin()
 
 	if txErr != nil {
 		log.Fatalln(txErr)
 	}
 
-	stmt := s.createLoadStmt(tableName, len(input.Columns()), tx)
+	stmt := s.createLoadStmt(tableName, input.Columns(), tx)
+
+	// Money columns hold minor units whatever type the input gives them,
+	// and decimals in tables created before they did.
+	types, err := s.loadTypes(tableName, input.Columns(), input.Types())
+	if err != nil {
+		log.Fatal("Failed to read column types of ", tableName, err)
+	}
 
 	row := input.ReadRow()
 	for {
 		if row == nil {
 			break
 		}
-		s.loadRow(tableName, len(input.Columns()), row, input.Types(), input.Options.TimeFormat, stmt, true)
+		s.loadRow(tableName, len(input.Columns()), row, types, input.TimeFormat(), stmt, true)
 		row = input.ReadRow()
 	}
 	stmt.Close()
@@ -88,19 +121,272 @@ func (s *Storage) Load(tableName string, input *input.CSVInput) error {
 	return err
 }
 
-func (s *Storage) Query(query string) (*sql.Rows, error) {
-	rows, err := s.db.Query(query)
+func (s *Storage) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := s.db.Query(query, args...)
 	return rows, err
 }
 
-func (s *Storage) QueryRow(query string) *sql.Row {
-	return s.db.QueryRow(query)
+func (s *Storage) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(query, args...)
+}
+
+func (s *Storage) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(query, args...)
+}
+
+// ImportedHash returns the content hash recorded when path was last
+// imported, or an empty string if it has never been imported.
+func (s *Storage) ImportedHash(path string) (string, error) {
+	var hash string
+	err := s.db.QueryRow(`SELECT hash FROM ms_imports WHERE path = ?`, path).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// MarkImported records that path, with the given content hash, has been
+// loaded into tableName.
+func (s *Storage) MarkImported(path string, hash string, tableName string) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO ms_imports(path, hash, tablename) VALUES(?, ?, ?)`, path, hash, tableName)
+	return err
+}
+
+// Import loads input, read from the file at path with the given content
+// hash, into tableName and records which rows came from it, so they can
+// be deleted with DeleteImported when the file changes.
+func (s *Storage) Import(path string, hash string, tableName string, input input.Input) error {
+	first, err := s.lastRow(tableName)
+	if err != nil {
+		return err
+	}
+	err = s.Load(tableName, input)
+	if err != nil {
+		return err
+	}
+	last, err := s.lastRow(tableName)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO ms_imports(path, hash, tablename, firstrow, lastrow) VALUES(?, ?, ?, ?, ?)`,
+		path, hash, tableName, first+1, last)
+	return err
+}
+
+// DeleteImported deletes the rows Import loaded from the file at path.
+// Files imported before rows were recorded keep theirs.
+func (s *Storage) DeleteImported(path string) error {
+	var tableName string
+	var first, last sql.NullInt64
+	err := s.db.QueryRow(`SELECT tablename, firstrow, lastrow FROM ms_imports WHERE path = ?`, path).Scan(&tableName, &first, &last)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !first.Valid || !last.Valid {
+		return nil
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`DELETE FROM "%v" WHERE rowid BETWEEN ? AND ?`, tableName), first.Int64, last.Int64)
+	return err
+}
+
+// lastRow returns the largest rowid of tableName, 0 if it is empty or
+// does not exist. Rows loaded at once get the rowids after it.
+func (s *Storage) lastRow(tableName string) (int64, error) {
+	columns, err := s.Columns(tableName)
+	if err != nil || len(columns) == 0 {
+		return 0, err
+	}
+	var last int64
+	err = s.db.QueryRow(fmt.Sprintf(`SELECT IFNULL(MAX(rowid), 0) FROM "%v"`, tableName)).Scan(&last)
+	return last, err
+}
+
+// column is a column of a table as declared.
+type column struct {
+	name  string
+	ctype string
+	pk    bool
+}
+
+func (s *Storage) tableInfo(tableName string) ([]column, error) {
+	var columns []column
+	rows, err := s.db.Query(fmt.Sprintf(`PRAGMA table_info("%v")`, tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var c column
+		var dflt sql.NullString
+		err = rows.Scan(&cid, &c.name, &c.ctype, &notNull, &dflt, &pk)
+		if err != nil {
+			return nil, err
+		}
+		c.pk = pk > 0
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// Columns returns the column names of tableName, or nothing if the table
+// does not exist yet.
+func (s *Storage) Columns(tableName string) ([]string, error) {
+	info, err := s.tableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, c := range info {
+		columns = append(columns, c.name)
+	}
+	return columns, nil
+}
+
+// loadTypes returns the types values of headers are converted with when
+// loaded into tableName: input.AmountType for the money columns of the
+// table, the ones of types otherwise.
+func (s *Storage) loadTypes(tableName string, headers []string, types []string) ([]string, error) {
+	info, err := s.tableInfo(tableName)
+	if err != nil {
+		return nil, err
+	}
+	result := append([]string{}, types...)
+	for i, header := range headers {
+		result[i] = strings.Replace(result[i], input.AmountType, "REAL", 1)
+		for _, c := range info {
+			if strings.EqualFold(c.name, header) && strings.EqualFold(c.ctype, input.AmountType) {
+				result[i] = input.AmountType
+			}
+		}
+	}
+	return result, nil
+}
+
+// ConvertAmounts turns the named columns of tableName into money columns
+// of minor units, if they still hold decimals from before amounts were
+// kept exact. The table is rebuilt as SQLite can not change the type of
+// a column.
+func (s *Storage) ConvertAmounts(tableName string, columns ...string) error {
+	info, err := s.tableInfo(tableName)
+	if err != nil {
+		return err
+	}
+	var names, defs, values, keys []string
+	converted := false
+	for _, c := range info {
+		def, value := c.name+" "+c.ctype, c.name
+		for _, name := range columns {
+			if strings.EqualFold(c.name, name) && !strings.EqualFold(c.ctype, input.AmountType) {
+				def = c.name + " " + input.AmountType
+				value = fmt.Sprintf("CAST(ROUND(%v * %v) AS INTEGER)", c.name, money.Amount(1).Rescale(0, money.MaxDigits))
+				converted = true
+			}
+		}
+		names = append(names, c.name)
+		defs = append(defs, def)
+		values = append(values, value)
+		if c.pk {
+			keys = append(keys, c.name)
+		}
+	}
+	if !converted {
+		return nil
+	}
+	if len(keys) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%v)", strings.Join(keys, ", ")))
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE "%v_amounts" (%v)`, tableName, strings.Join(defs, ", ")),
+		// Rowids are kept as DeleteImported goes by them.
+		fmt.Sprintf(`INSERT INTO "%v_amounts"(rowid, %v) SELECT rowid, %v FROM "%v"`, tableName, strings.Join(names, ", "), strings.Join(values, ", "), tableName),
+		fmt.Sprintf(`DROP TABLE "%v"`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%v_amounts" RENAME TO "%v"`, tableName, tableName),
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RescaleAmounts turns the named money columns of the rows of tableName
+// in digits, by rowid, from minor units of money.MaxDigits digits into
+// ones of the digits given and records them in DigitsColumn. Amounts finer
+// than that are rounded, and the rowids of their rows returned.
+func (s *Storage) RescaleAmounts(tableName string, columns []string, digits map[int64]int) ([]int64, error) {
+	var rounded []int64
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`SELECT %v FROM "%v" WHERE rowid = ?`, strings.Join(columns, ", "), tableName)
+	var sets []string
+	for _, c := range columns {
+		sets = append(sets, c+" = ?")
+	}
+	update := fmt.Sprintf(`UPDATE "%v" SET %v, %v = ? WHERE rowid = ?`, tableName, strings.Join(sets, ", "), DigitsColumn)
+	for rowid, d := range digits {
+		amounts := make([]sql.NullInt64, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range amounts {
+			dest[i] = &amounts[i]
+		}
+		err = tx.QueryRow(query, rowid).Scan(dest...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		var args []interface{}
+		lossy := false
+		for _, a := range amounts {
+			if !a.Valid {
+				args = append(args, nil)
+				continue
+			}
+			amount := money.Amount(a.Int64).Rescale(money.MaxDigits, d)
+			lossy = lossy || amount.Rescale(d, money.MaxDigits) != money.Amount(a.Int64)
+			args = append(args, int64(amount))
+		}
+		if lossy {
+			rounded = append(rounded, rowid)
+		}
+		_, err = tx.Exec(update, append(args, d, rowid)...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return rounded, tx.Commit()
 }
 
-func (s *Storage) Exec(query string) (sql.Result, error) {
-	return s.db.Exec(query)
+// HasColumn reports whether tableName exists and has the named column.
+func (s *Storage) HasColumn(tableName string, column string) bool {
+	columns, err := s.Columns(tableName)
+	if err != nil {
+		log.Fatal("Failed to read columns of ", tableName, err)
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
 }
 
+// Save writes tableName to output. Amounts are written in major units of
+// the currency of their row, and DigitsColumn is left out.
 func (s *Storage) Save(tableName string, output *output.CSVOutput) error {
 	query := fmt.Sprintf("SELECT * FROM '%v'", tableName)
 	rows, err := s.db.Query(query)
@@ -122,16 +408,29 @@ func (s *Storage) Save(tableName string, output *output.CSVOutput) error {
 	for _, colType := range colTypes {
 		types = append(types, colType.DatabaseTypeName())
 	}
+	digitsCol := -1
+	for i, c := range columns {
+		if strings.EqualFold(c, DigitsColumn) {
+			digitsCol = i
+		}
+	}
+	without := func(values []string) []string {
+		if digitsCol < 0 {
+			return values
+		}
+		return append(append([]string{}, values[:digitsCol]...), values[digitsCol+1:]...)
+	}
 
-	err = output.WriteHeader(types, columns)
+	err = output.WriteHeader(without(types), without(columns))
 	if err != nil {
 		log.Fatal("Failed to write header to csvOutput")
 	}
 
+	nullVals := make([]sql.NullString, len(columns))
 	values := make([]string, len(columns))
 	pVals := make([]interface{}, len(columns))
-	for i, _ := range values {
-		pVals[i] = &values[i]
+	for i, _ := range nullVals {
+		pVals[i] = &nullVals[i]
 	}
 
 	for rows.Next() {
@@ -139,7 +438,16 @@ func (s *Storage) Save(tableName string, output *output.CSVOutput) error {
 		if err != nil {
 			log.Fatal("Failed to Save:", err)
 		}
-		csvVals, err := ValString(values, types, output.Options.TimeFormat)
+		for i, v := range nullVals {
+			values[i] = v.String
+		}
+		if digitsCol >= 0 && values[digitsCol] != "" {
+			err = rescaleValues(values, types, values[digitsCol])
+			if err != nil {
+				log.Fatal("Failed to Save:", err)
+			}
+		}
+		csvVals, err := ValString(without(values), without(types), output.Options.TimeFormat)
 		if err != nil {
 			log.Fatal("Failed to convert data to csv string")
 		}
@@ -174,13 +482,33 @@ func (s *Storage) createTable(tableName string, headers []string, types []string
 	return err
 }
 
-func (s *Storage) createLoadStmt(tableName string, colCount int, db *sql.Tx) *sql.Stmt {
+// EnsureColumns adds the columns an existing table is missing, so inputs
+// with extra columns can be loaded into tables created by older ones.
+func (s *Storage) EnsureColumns(tableName string, headers []string, types []string) error {
+	existing, err := s.Columns(tableName)
+	if err != nil || len(existing) == 0 {
+		return err
+	}
+	for i, header := range headers {
+		if s.HasColumn(tableName, header) {
+			continue
+		}
+		_, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v", tableName, header, types[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) createLoadStmt(tableName string, headers []string, db *sql.Tx) *sql.Stmt {
+	colCount := len(headers)
 	if colCount == 0 {
 		log.Fatalln("Nothing to build insert with!")
 	}
 	var buffer strings.Builder
 
-	buffer.WriteString("INSERT INTO " + (tableName) + " VALUES (")
+	buffer.WriteString("INSERT INTO " + (tableName) + " (" + strings.Join(headers, ", ") + ") VALUES (")
 	// Don't write the comma for the last column
 	for i := 1; i <= colCount; i++ {
 		buffer.WriteString("nullif(?,'')")
@@ -191,7 +519,7 @@ func (s *Storage) createLoadStmt(tableName string, colCount int, db *sql.Tx) *sq
 
 	buffer.WriteString(");")
 
-	stmt, err := s.db.Prepare(buffer.String())
+	stmt, err := db.Prepare(buffer.String())
 
 	if err != nil {
 		log.Fatalln("Could not create load stmt:", err)
@@ -206,7 +534,10 @@ func (s *Storage) loadRow(tableName string, colCount int, values []string, types
 
 	vals, err := StringVal(values, types, timeFormat)
 	if err != nil {
-		log.Fatal("loadRow: Failed to convert data", err)
+		if verbose {
+			log.Printf("Bad row: %v\n", err)
+		}
+		return err
 	}
 
 	_, err = stmt.Exec(vals...)
@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"database/sql"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"testing"
 
 	"../input"
@@ -38,7 +41,7 @@ func NewTestCSVInput() (csvInput *input.CSVInput, fp *os.File) {
 }
 
 func TestSQLiteStorageLoadInput(t *testing.T) {
-	storage := NewStorage()
+	storage := NewStorage("")
 	defer storage.Close()
 
 	input, fp := NewTestCSVInput()
@@ -57,7 +60,7 @@ func TestSQLiteStorageSave(t *testing.T) {
 		tempFile *os.File
 	)
 
-	storage := NewStorage()
+	storage := NewStorage("")
 	input, fp := NewTestCSVInput()
 	defer fp.Close()
 	defer os.Remove(fp.Name())
@@ -68,7 +71,7 @@ func TestSQLiteStorageSave(t *testing.T) {
 	tempFile, err = ioutil.TempFile(os.TempDir(), "moneysense_test")
 
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	defer os.Remove(tempFile.Name())
@@ -84,7 +87,7 @@ func TestSQLiteStorageSave(t *testing.T) {
 }
 
 func TestStorageQueryNormalSQL(t *testing.T) {
-	storage := NewStorage()
+	storage := NewStorage("")
 	input, fp := NewTestCSVInput()
 	defer fp.Close()
 	defer os.Remove(fp.Name())
@@ -97,13 +100,13 @@ func TestStorageQueryNormalSQL(t *testing.T) {
 	rows, rowsErr := storage.Query(sqlString)
 
 	if rowsErr != nil {
-		t.Fatalf(rowsErr.Error())
+		t.Fatal(rowsErr)
 	}
 
 	cols, colsErr := rows.Columns()
 
 	if colsErr != nil {
-		t.Fatalf(colsErr.Error())
+		t.Fatal(colsErr)
 	}
 
 	if len(cols) != 1 {
@@ -121,7 +124,7 @@ func TestStorageQueryNormalSQL(t *testing.T) {
 }
 
 func TestSQLiteStorageExec(t *testing.T) {
-	storage := NewStorage()
+	storage := NewStorage("")
 	input, fp := NewTestCSVInput()
 	defer fp.Close()
 	defer os.Remove(fp.Name())
@@ -134,16 +137,327 @@ func TestSQLiteStorageExec(t *testing.T) {
 	result, resultErr := storage.Exec(sqlString)
 
 	if resultErr != nil {
-		t.Fatalf(resultErr.Error())
+		t.Fatal(resultErr)
 	}
 
 	rowsAffected, rowsErr := result.RowsAffected()
 
 	if rowsErr != nil {
-		t.Fatalf(rowsErr.Error())
+		t.Fatal(rowsErr)
 	}
 
 	if rowsAffected != 1 {
 		t.Fatalf("Expected 1 row affected, got (%v)", rowsAffected)
 	}
 }
+
+func TestSQLiteStorageRemembersImports(t *testing.T) {
+	dbFile, err := ioutil.TempFile(os.TempDir(), "moneysense_db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbFile.Close()
+	defer os.Remove(dbFile.Name())
+
+	storage := NewStorage(dbFile.Name())
+	hash, err := storage.ImportedHash("/tmp/history/a.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "" {
+		t.Fatalf("Expected no hash for a new file, got (%v)", hash)
+	}
+
+	err = storage.MarkImported("/tmp/history/a.csv", "abc", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	storage = NewStorage(dbFile.Name())
+	defer storage.Close()
+	hash, err = storage.ImportedHash("/tmp/history/a.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "abc" {
+		t.Fatalf("Expected hash abc after reopening, got (%v)", hash)
+	}
+}
+
+func TestSQLiteStorageSaveNulls(t *testing.T) {
+	fp := test_util.OpenCSVFromString(`TEXT,TIMESTAMP,REAL
+mechant,since,min
+apple,01/02/2019,
+pear,,3
+`, "nulls.csv")
+	defer fp.Close()
+	defer os.Remove(fp.Name())
+
+	opts := &input.CSVInputOptions{
+		Separator:  ',',
+		ReadFrom:   fp,
+		TimeFormat: "01/02/2006",
+	}
+	csvInput, err := input.NewCSVInput(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := NewStorage("")
+	defer storage.Close()
+	err = storage.Load("nulls", csvInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nulls int
+	storage.QueryRow("SELECT count(*) FROM nulls WHERE since IS NULL OR min IS NULL").Scan(&nulls)
+	if nulls != 2 {
+		t.Fatalf("Expected 2 rows with NULLs, got (%v)", nulls)
+	}
+
+	var buf bytes.Buffer
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{
+		Separator:  ',',
+		WriteTo:    &buf,
+		TimeFormat: "01/02/2006",
+	})
+	err = storage.Save("nulls", csvOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "TEXT,TIMESTAMP,REAL\nmechant,since,min\napple,01/02/2019,\npear,,3\n"
+	if buf.String() != expected {
+		t.Fatalf("Save wrote %q, want %q", buf.String(), expected)
+	}
+}
+
+func loadCSVString(t *testing.T, storage *Storage, tableName string, contents string) {
+	fp := test_util.OpenCSVFromString(contents, tableName+".csv")
+	defer fp.Close()
+	defer os.Remove(fp.Name())
+
+	csvInput, err := input.NewCSVInput(&input.CSVInputOptions{
+		Separator:  ',',
+		ReadFrom:   fp,
+		TimeFormat: "01/02/2006",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Load(tableName, csvInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStorageKeepsAmountsInMinorUnits(t *testing.T) {
+	storage := NewStorage("")
+	defer storage.Close()
+	loadCSVString(t, storage, "amounts", `TEXT,AMOUNT INTEGER
+mechant,credit
+apple,20.5
+pear,0.1234
+kiwi,1.23456
+`)
+
+	var credits []int64
+	rows, err := storage.Query("SELECT credit FROM amounts ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var credit int64
+		rows.Scan(&credit)
+		credits = append(credits, credit)
+	}
+	rows.Close()
+	// The amount finer than money.MaxDigits is a bad row, not rounded.
+	if len(credits) != 2 || credits[0] != 205000 || credits[1] != 1234 {
+		t.Fatalf("Expected credits [205000 1234], got %v", credits)
+	}
+
+	var buf bytes.Buffer
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{Separator: ',', WriteTo: &buf})
+	err = storage.Save("amounts", csvOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "TEXT,AMOUNT INTEGER\nmechant,credit\napple,20.5\npear,0.1234\n"
+	if buf.String() != expected {
+		t.Fatalf("Save wrote %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestSQLiteStorageConvertAmounts(t *testing.T) {
+	storage := NewStorage("")
+	defer storage.Close()
+	_, err := storage.Exec(`CREATE TABLE goals (name TEXT PRIMARY KEY, target REAL, note TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.Exec(`INSERT INTO goals VALUES ('house', 2000.25, 'a'), ('car', NULL, 'b')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = storage.ConvertAmounts("goals", "target")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var target sql.NullInt64
+	storage.QueryRow("SELECT target FROM goals WHERE name = 'house'").Scan(&target)
+	if !target.Valid || target.Int64 != 20002500 {
+		t.Fatalf("Expected target 20002500, got %v", target)
+	}
+	storage.QueryRow("SELECT target FROM goals WHERE name = 'car'").Scan(&target)
+	if target.Valid {
+		t.Fatalf("Expected no target for car, got %v", target.Int64)
+	}
+
+	// Rows added with a decimal input after the conversion are converted.
+	loadCSVString(t, storage, "goals", `TEXT,REAL,TEXT
+name,target,note
+bike,300,c
+`)
+	storage.QueryRow("SELECT target FROM goals WHERE name = 'bike'").Scan(&target)
+	if target.Int64 != 3000000 {
+		t.Fatalf("Expected target 3000000 for bike, got %v", target.Int64)
+	}
+
+	// The primary key survives the rebuild.
+	_, err = storage.Exec(`INSERT INTO goals VALUES ('house', 1, 'd')`)
+	if err == nil {
+		t.Fatalf("Expected a duplicate name to be rejected")
+	}
+}
+
+func TestSQLiteStorageDeletesImportedRows(t *testing.T) {
+	storage := NewStorage("")
+	defer storage.Close()
+	importCSV := func(path string, contents string) {
+		fp := test_util.OpenCSVFromString(contents, "import.csv")
+		defer fp.Close()
+		defer os.Remove(fp.Name())
+		csvInput, err := input.NewCSVInput(&input.CSVInputOptions{Separator: ',', ReadFrom: fp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.Import(path, contents, "rules", csvInput)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	importCSV("/tmp/rules/a.csv", "TEXT,TEXT\nmechant,category\napple,computer\nsafeway,grocery\n")
+	importCSV("/tmp/rules/b.csv", "TEXT,TEXT\nmechant,category\nshell,fuel\n")
+
+	// a.csv changed, its rows are replaced and the ones of b.csv kept.
+	err := storage.DeleteImported("/tmp/rules/a.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importCSV("/tmp/rules/a.csv", "TEXT,TEXT\nmechant,category\nsafeway,food\n")
+
+	var mechants []string
+	rows, err := storage.Query("SELECT mechant || ':' || category FROM rules ORDER BY mechant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var m string
+		rows.Scan(&m)
+		mechants = append(mechants, m)
+	}
+	rows.Close()
+	if strings.Join(mechants, " ") != "safeway:food shell:fuel" {
+		t.Fatalf("Expected safeway:food shell:fuel, got %v", mechants)
+	}
+
+	// Deleting a file never imported deletes nothing.
+	err = storage.DeleteImported("/tmp/rules/c.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStorageDeleteImportedFails(t *testing.T) {
+	storage := NewStorage("")
+	storage.Close()
+	if err := storage.DeleteImported("/tmp/rules/a.csv"); err == nil {
+		t.Errorf("Expected DeleteImported() on a closed database to fail")
+	}
+}
+
+func TestSQLiteStorageOpensEscapedPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := dir + "/ms?cache=private#50%.db"
+	storage := NewStorage(dbPath)
+	defer storage.Close()
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("Expected the database in %v: %v", dbPath, err)
+	}
+}
+
+func TestStringValBadDate(t *testing.T) {
+	types := []string{"TIMESTAMP", "TEXT"}
+	if _, err := StringVal([]string{"01/03/2019", "SAFEWAY"}, types, "01/02/2006"); err != nil {
+		t.Errorf("StringVal() = %v", err)
+	}
+	if _, err := StringVal([]string{"Total", "SAFEWAY"}, types, "01/02/2006"); err == nil {
+		t.Errorf("Expected StringVal() to fail on a bad date")
+	}
+}
+
+func TestSQLiteStorageRescaleAmounts(t *testing.T) {
+	storage := NewStorage("")
+	defer storage.Close()
+	loadCSVString(t, storage, "rescaled", `TEXT,AMOUNT INTEGER,AMOUNT INTEGER,INTEGER
+mechant,credit,debit,digits
+yen,1500,,
+dinar,1.234,,
+usd,,20.5,
+odd,12.5,,
+`)
+	rounded, err := storage.RescaleAmounts("rescaled", []string{"credit", "debit"}, map[int64]int{1: 0, 2: 3, 3: 2, 4: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounded) != 1 || rounded[0] != 4 {
+		t.Errorf("Expected row 4 to be rounded, got %v", rounded)
+	}
+
+	var amounts []string
+	rows, err := storage.Query("SELECT IFNULL(credit, '') || ':' || IFNULL(debit, '') || ':' || digits FROM rescaled ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var a string
+		rows.Scan(&a)
+		amounts = append(amounts, a)
+	}
+	rows.Close()
+	if strings.Join(amounts, " ") != "1500::0 1234::3 :2050:2 13::0" {
+		t.Errorf("Unexpected amounts %v", amounts)
+	}
+
+	// Files are written in major units, without the digits.
+	var buf bytes.Buffer
+	csvOutput := output.NewCSVOutput(&output.CSVOutputOptions{Separator: ',', WriteTo: &buf})
+	err = storage.Save("rescaled", csvOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "TEXT,AMOUNT INTEGER,AMOUNT INTEGER\nmechant,credit,debit\nyen,1500,\ndinar,1.234,\nusd,,20.5\nodd,13,\n"
+	if buf.String() != expected {
+		t.Errorf("Save wrote %q, want %q", buf.String(), expected)
+	}
+}
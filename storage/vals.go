@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"fmt"
 	"log"
+	"strconv"
 	"time"
+
+	"../input"
+	"../money"
 )
 
 func ValString(values []string, types []string, timeFormat string) ([]string, error) {
@@ -11,13 +16,24 @@ func ValString(values []string, types []string, timeFormat string) ([]string, er
 	}
 	result := make([]string, len(types))
 	for i, tname := range types {
-		switch tname {
-		case "TIMESTAMP":
+		switch {
+		case values[i] == "":
+			result[i] = ""
+		case tname == "TIMESTAMP":
 			vtime, err := time.Parse(time.RFC3339Nano, values[i])
 			if err != nil {
 				log.Fatal("Failed to parse time according to timeFormat:", timeFormat)
 			}
 			result[i] = vtime.Format(timeFormat)
+		case tname == input.AmountType:
+			minor, err := strconv.ParseInt(values[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Bad amount %q", values[i])
+			}
+			result[i] = money.Amount(minor).Text(money.MaxDigits)
+			if result[i] == "" {
+				result[i] = "0"
+			}
 		default:
 			result[i] = values[i]
 		}
@@ -25,19 +41,48 @@ func ValString(values []string, types []string, timeFormat string) ([]string, er
 	return result, nil
 }
 
+// rescaleValues turns the money values of a row, in minor units of digits
+// digits, into ones of money.MaxDigits digits as ValString takes them.
+func rescaleValues(values []string, types []string, digits string) error {
+	d, err := strconv.Atoi(digits)
+	if err != nil {
+		return fmt.Errorf("Bad digits %q", digits)
+	}
+	for i, tname := range types {
+		if tname != input.AmountType || values[i] == "" {
+			continue
+		}
+		minor, err := strconv.ParseInt(values[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Bad amount %q", values[i])
+		}
+		values[i] = strconv.FormatInt(int64(money.Amount(minor).Rescale(d, money.MaxDigits)), 10)
+	}
+	return nil
+}
+
 func StringVal(values []string, types []string, timeFormat string) ([]interface{}, error) {
 	if len(types) != len(values) {
 		log.Fatal("StringVal can't handle unmatched types and values!")
 	}
 	var result []interface{}
 	for i, tname := range types {
-		switch tname {
-		case "TIMESTAMP":
+		switch {
+		case values[i] == "":
+			// Loaded as NULL.
+			result = append(result, values[i])
+		case tname == "TIMESTAMP":
 			vtime, err := time.Parse(timeFormat, values[i])
 			if err != nil {
-				log.Fatal("Failed to parse time according to timeFormat:", timeFormat)
+				return nil, fmt.Errorf("Bad date %q: %v", values[i], err)
 			}
 			result = append(result, vtime)
+		case tname == input.AmountType:
+			amount, err := money.Parse(values[i], '.', money.MaxDigits)
+			if err != nil {
+				return nil, fmt.Errorf("Bad amount %q: %v", values[i], err)
+			}
+			result = append(result, int64(amount))
 		default:
 			result = append(result, values[i])
 		}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"./money"
+)
+
+// Suggester is a naive Bayes model over the words of mechant names and
+// the order of magnitude of amounts, trained on what has been classified.
+type Suggester struct {
+	docs       int
+	categories map[string]int
+	tokens     map[string]map[string]int
+	totals     map[string]int
+	vocabulary map[string]bool
+}
+
+// Suggestion is a likely category with the model's confidence in it.
+type Suggestion struct {
+	Category   string
+	Confidence float64
+}
+
+func NewSuggester() *Suggester {
+	return &Suggester{
+		categories: make(map[string]int),
+		tokens:     make(map[string]map[string]int),
+		totals:     make(map[string]int),
+		vocabulary: make(map[string]bool),
+	}
+}
+
+// suggestTokens splits a mechant into its words, dropping store numbers
+// and the like, and adds a token for the size of a non-zero amount.
+func suggestTokens(mechant string, amount float64) []string {
+	var result []string
+	words := strings.FieldsFunc(strings.ToUpper(mechant), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if len(w) < 2 || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		result = append(result, w)
+	}
+	if amount > 0 {
+		result = append(result, fmt.Sprintf("$%d", int(math.Floor(math.Log10(amount)*2))))
+	}
+	return result
+}
+
+// Train adds one classified transaction to the model. An amount of zero
+// trains on the mechant alone.
+func (s *Suggester) Train(mechant string, amount float64, category string) {
+	tokens := suggestTokens(mechant, amount)
+	if len(tokens) == 0 || category == "" {
+		return
+	}
+	s.docs++
+	s.categories[category]++
+	if s.tokens[category] == nil {
+		s.tokens[category] = make(map[string]int)
+	}
+	for _, t := range tokens {
+		s.tokens[category][t]++
+		s.totals[category]++
+		s.vocabulary[t] = true
+	}
+}
+
+// Suggest returns up to n categories for a transaction, the most likely
+// first, with confidences summing to at most 1.
+func (s *Suggester) Suggest(mechant string, amount float64, n int) []Suggestion {
+	tokens := suggestTokens(mechant, amount)
+	if s.docs == 0 || len(tokens) == 0 {
+		return nil
+	}
+
+	logs := make(map[string]float64)
+	maxLog := math.Inf(-1)
+	for category, count := range s.categories {
+		l := math.Log(float64(count) / float64(s.docs))
+		for _, t := range tokens {
+			// Laplace smoothing keeps unseen words from ruling a category out.
+			l += math.Log(float64(s.tokens[category][t]+1) / float64(s.totals[category]+len(s.vocabulary)))
+		}
+		logs[category] = l
+		if l > maxLog {
+			maxLog = l
+		}
+	}
+
+	var sum float64
+	var result []Suggestion
+	for category, l := range logs {
+		p := math.Exp(l - maxLog)
+		sum += p
+		result = append(result, Suggestion{Category: category, Confidence: p})
+	}
+	for i := range result {
+		result[i].Confidence /= sum
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].Category < result[j].Category
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// trainSuggester builds a Suggester from the classifier rules and the
+// transactions they classify or that were imported with a category.
+func trainSuggester(rules RuleSet, transactions []Transaction) *Suggester {
+	s := NewSuggester()
+	for _, r := range rules {
+		if r.Match != MatchRegexp {
+			s.Train(strings.Trim(r.Pattern, "*?"), 0, r.Category)
+		}
+	}
+	for _, t := range transactions {
+		amount := t.Amount.Float(money.MaxDigits)
+		if t.ImportedCategory != "" {
+			s.Train(t.Mechant, amount, t.ImportedCategory)
+		} else if rule := rules.Find(t.Mechant, amount, t.Date); rule != nil {
+			s.Train(t.Mechant, amount, rule.Category)
+		}
+	}
+	return s
+}
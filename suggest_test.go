@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestTokens(t *testing.T) {
+	cases := []struct {
+		mechant  string
+		amount   float64
+		expected []string
+	}{
+		{"SAFEWAY #1234", 0, []string{"SAFEWAY"}},
+		{"Shell Oil 5522", 40, []string{"SHELL", "OIL", "$3"}},
+		{"A 7-ELEVEN", 5, []string{"ELEVEN", "$1"}},
+		{"1234", 0, nil},
+	}
+	for _, c := range cases {
+		tokens := suggestTokens(c.mechant, c.amount)
+		if !reflect.DeepEqual(tokens, c.expected) {
+			t.Errorf("suggestTokens(%q, %v) = %v, expected %v", c.mechant, c.amount, tokens, c.expected)
+		}
+	}
+}
+
+func TestSuggesterSuggest(t *testing.T) {
+	s := NewSuggester()
+	if suggestions := s.Suggest("SAFEWAY", 20, 3); suggestions != nil {
+		t.Errorf("Expected no suggestions from an untrained model, got %v", suggestions)
+	}
+	s.Train("SAFEWAY #1234", 45.10, "grocery")
+	s.Train("SAFEWAY #0042", 61.30, "grocery")
+	s.Train("WHOLE FOODS MARKET", 52.00, "grocery")
+	s.Train("SHELL OIL 5522", 40, "fuel")
+	s.Train("CHEVRON 0091", 38.50, "fuel")
+	s.Train("NETFLIX.COM", 15.99, "streaming")
+	s.Train("1234", 0, "ignored")
+	s.Train("SPOTIFY", 9.99, "")
+
+	cases := []struct {
+		mechant  string
+		amount   float64
+		n        int
+		expected []string
+	}{
+		{"SAFEWAY #9999", 50, 3, []string{"grocery", "fuel", "streaming"}},
+		{"SHELL OIL 1111", 0, 1, []string{"fuel"}},
+		{"NETFLIX.COM", 15.99, 1, []string{"streaming"}},
+		{"#1", 0, 3, nil},
+	}
+	for _, c := range cases {
+		var categories []string
+		var sum float64
+		for _, sg := range s.Suggest(c.mechant, c.amount, c.n) {
+			categories = append(categories, sg.Category)
+			sum += sg.Confidence
+		}
+		if !reflect.DeepEqual(categories, c.expected) {
+			t.Errorf("Suggest(%q, %v, %v) = %v, expected %v", c.mechant, c.amount, c.n, categories, c.expected)
+		}
+		if sum > 1.0000001 {
+			t.Errorf("Suggest(%q) confidences add up to %v", c.mechant, sum)
+		}
+	}
+}
+
+func TestTrainSuggesterPrefersImportedCategory(t *testing.T) {
+	rules := RuleSet{{Pattern: "COSTCO", Category: "shopping"}}
+	for _, r := range rules {
+		r.compile()
+	}
+	transactions := []Transaction{
+		{Mechant: "COSTCO WHSE", ImportedCategory: "grocery"},
+		{Mechant: "COSTCO WHSE", ImportedCategory: "grocery"},
+	}
+	s := trainSuggester(rules, transactions)
+	suggestions := s.Suggest("COSTCO WHSE", 0, 1)
+	if len(suggestions) != 1 || suggestions[0].Category != "grocery" {
+		t.Errorf("Expected grocery, got %v", suggestions)
+	}
+}
+
+func TestPickSuggestion(t *testing.T) {
+	suggestions := []Suggestion{{"grocery", 0.7}, {"fuel", 0.2}}
+	cases := []struct {
+		answer      string
+		suggestions []Suggestion
+		expected    string
+	}{
+		{"", suggestions, "grocery"},
+		{"", nil, ""},
+		{"1", suggestions, "grocery"},
+		{"2", suggestions, "fuel"},
+		// Numbers out of range are taken as a category.
+		{"3", suggestions, "3"},
+		{"0", suggestions, "0"},
+		{"1", nil, "1"},
+		{"shopping", suggestions, "shopping"},
+	}
+	for _, c := range cases {
+		if category := pickSuggestion(c.answer, c.suggestions); category != c.expected {
+			t.Errorf("pickSuggestion(%q, %v) = %q, expected %q", c.answer, c.suggestions, category, c.expected)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"./money"
+)
+
+// Statuses of a pair in ms_transfers. Matched pairs were paired by
+// MatchTransfers on their own, confirmed ones by the user, and rejected
+// ones are never proposed again.
+const (
+	TransferMatched   = "matched"
+	TransferConfirmed = "confirmed"
+	TransferRejected  = "rejected"
+)
+
+// Transfer is money moved between two accounts of ours: Out left one of
+// them and In arrived in the other.
+type Transfer struct {
+	Out    Transaction
+	In     Transaction
+	Status string
+}
+
+// transferKey identifies the pair of out and in.
+func transferKey(out string, in string) string {
+	return out + "|" + in
+}
+
+// allTransactions lists the whole history of every account, in the
+// currency of every transaction and, where there is an exchange rate, in
+// the base currency.
+func (ms *MoneySense) allTransactions() ([]Transaction, error) {
+	var result []Transaction
+
+	rates := ms.loadRates()
+	currencies := ms.accountCurrencies()
+
+	query := fmt.Sprintf(`SELECT IFNULL(%v, ''), IFNULL(%v, '%v'), date, mechant, %v, IFNULL(%v, '') FROM "%v" ORDER BY date ASC`,
+		FingerprintColumn, AccountColumn, DefaultAccount, signedAmount, CurrencyColumn, ms.history)
+	rows, err := ms.store.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t Transaction
+		var amount money.Amount
+		err = rows.Scan(&t.ID, &t.Account, &t.Date, &t.Mechant, &amount, &t.Currency)
+		if err != nil {
+			return nil, err
+		}
+		ms.setOriginal(&t, amount, currencies)
+		t.converted = ms.base != "" && ms.convert(&t, rates) == nil
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func (ms *MoneySense) loadTransferPairs() map[string]string {
+	pairs := make(map[string]string)
+
+	rows, err := ms.store.Query(`SELECT a, b, status FROM ms_transfers`)
+	if err != nil {
+		log.Fatal("Failed to query transfers: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b, status string
+		err = rows.Scan(&a, &b, &status)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pairs[transferKey(a, b)] = status
+	}
+	return pairs
+}
+
+// transferIDs returns the transactions that are one side of a transfer.
+func (ms *MoneySense) transferIDs() map[string]bool {
+	ids := make(map[string]bool)
+	rows, err := ms.store.Query(`SELECT a, b FROM ms_transfers WHERE status != ?`, TransferRejected)
+	if err != nil {
+		log.Fatal("Failed to query transfers: ", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		err = rows.Scan(&a, &b)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ids[a] = true
+		ids[b] = true
+	}
+	return ids
+}
+
+// transferTolerance is how far apart, as a fraction of the amount that
+// went out, the amounts of a transfer between accounts in different
+// currencies can be in the base currency. The two banks rarely convert
+// at the same rate, and the exchange usually costs a fee.
+const transferTolerance = 0.02
+
+// transferCandidates pairs every transaction not yet part of a transfer
+// with the ones in other accounts at most days apart that can be the
+// other side of it, leaving out rejected pairs.
+func (ms *MoneySense) transferCandidates(days int) ([]Transfer, error) {
+	transactions, err := ms.allTransactions()
+	if err != nil {
+		return nil, err
+	}
+	return matchCandidates(transactions, days, ms.loadTransferPairs(), ms.transferIDs()), nil
+}
+
+// matchCandidates pairs the transactions, sorted by date, that went out
+// with the ones that came in to another account at most days apart: for
+// the same currency of equal and opposite amount, and across currencies,
+// when both were converted into the base currency, of opposite amounts
+// within transferTolerance in it. The transactions in taken and the pairs
+// already in pairs are left out.
+func matchCandidates(transactions []Transaction, days int, pairs map[string]string, taken map[string]bool) []Transfer {
+	var result []Transfer
+
+	type key struct {
+		currency string
+		amount   money.Amount
+	}
+	// The incoming transactions by currency and amount, each list sorted
+	// by date, and all of them from the smallest to the largest amount in
+	// the base currency.
+	sameCurrency := make(map[key][]int)
+	var byAmount []int
+	for i, in := range transactions {
+		if in.Original >= 0 || taken[in.ID] {
+			continue
+		}
+		k := key{in.Currency, -in.Original}
+		sameCurrency[k] = append(sameCurrency[k], i)
+		if in.converted {
+			byAmount = append(byAmount, i)
+		}
+	}
+	sort.SliceStable(byAmount, func(a, b int) bool {
+		return transactions[byAmount[a]].Amount > transactions[byAmount[b]].Amount
+	})
+
+	window := time.Duration(days) * 24 * time.Hour
+	for _, out := range transactions {
+		if out.Original <= 0 || taken[out.ID] {
+			continue
+		}
+		var matches []int
+		match := func(i int) {
+			in := transactions[i]
+			if in.Account == out.Account {
+				return
+			}
+			if _, ok := pairs[transferKey(out.ID, in.ID)]; ok {
+				return
+			}
+			matches = append(matches, i)
+		}
+
+		same := sameCurrency[key{out.Currency, out.Original}]
+		first := sort.Search(len(same), func(i int) bool {
+			return !transactions[same[i]].Date.Before(out.Date.Add(-window))
+		})
+		for _, i := range same[first:] {
+			if transactions[i].Date.After(out.Date.Add(window)) {
+				break
+			}
+			match(i)
+		}
+
+		if out.converted {
+			tolerance := money.Amount(float64(out.Amount) * transferTolerance)
+			first = sort.Search(len(byAmount), func(i int) bool {
+				return -transactions[byAmount[i]].Amount >= out.Amount-tolerance
+			})
+			for _, i := range byAmount[first:] {
+				in := transactions[i]
+				if -in.Amount > out.Amount+tolerance {
+					break
+				}
+				gap := in.Date.Sub(out.Date)
+				if in.Currency == out.Currency || gap > window || gap < -window {
+					continue
+				}
+				match(i)
+			}
+		}
+
+		sort.Ints(matches)
+		for _, i := range matches {
+			result = append(result, Transfer{Out: out, In: transactions[i]})
+		}
+	}
+	return result
+}
+
+// MatchTransfers marks the pairs of transactions that can only be a
+// transfer between our accounts as one, and returns how many it marked
+// along with the ambiguous pairs left for the user to confirm or reject.
+func (ms *MoneySense) MatchTransfers(days int) (int, []Transfer, error) {
+	var matched int
+	var ambiguous []Transfer
+
+	candidates, err := ms.transferCandidates(days)
+	if err != nil {
+		return 0, nil, err
+	}
+	count := make(map[string]int)
+	for _, c := range candidates {
+		count[c.Out.ID]++
+		count[c.In.ID]++
+	}
+	for _, c := range candidates {
+		if count[c.Out.ID] > 1 || count[c.In.ID] > 1 {
+			ambiguous = append(ambiguous, c)
+			continue
+		}
+		err = ms.setTransfer(c.Out.ID, c.In.ID, TransferMatched)
+		if err != nil {
+			return matched, ambiguous, err
+		}
+		matched++
+	}
+	return matched, ambiguous, nil
+}
+
+// Transfers lists the pairs marked as transfers.
+func (ms *MoneySense) Transfers() ([]Transfer, error) {
+	var result []Transfer
+
+	transactions, err := ms.allTransactions()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Transaction)
+	for _, t := range transactions {
+		byID[t.ID] = t
+	}
+	rows, err := ms.store.Query(`SELECT a, b, status FROM ms_transfers WHERE status != ? ORDER BY rowid ASC`, TransferRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b string
+		var t Transfer
+		err = rows.Scan(&a, &b, &t.Status)
+		if err != nil {
+			return nil, err
+		}
+		t.Out, t.In = byID[a], byID[b]
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// ConfirmTransfer marks the pair of out and in as a transfer, whether the
+// matcher proposed it or not.
+func (ms *MoneySense) ConfirmTransfer(out string, in string) error {
+	transactions, err := ms.allTransactions()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]Transaction)
+	for _, t := range transactions {
+		byID[t.ID] = t
+	}
+	o, ok := byID[out]
+	if !ok {
+		return fmt.Errorf("No transaction %v", out)
+	}
+	i, ok := byID[in]
+	if !ok {
+		return fmt.Errorf("No transaction %v", in)
+	}
+	if o.Original < 0 && i.Original > 0 {
+		o, i = i, o
+	}
+	if o.Original <= 0 || i.Original >= 0 {
+		return fmt.Errorf("%v and %v do not move money from one account to another", out, in)
+	}
+	taken := ms.transferIDs()
+	if taken[o.ID] || taken[i.ID] {
+		if ms.loadTransferPairs()[transferKey(o.ID, i.ID)] == "" {
+			return fmt.Errorf("%v or %v is already part of another transfer", out, in)
+		}
+	}
+	return ms.setTransfer(o.ID, i.ID, TransferConfirmed)
+}
+
+// RejectTransfer records that out and in are not a transfer, undoing the
+// matcher if it paired them.
+func (ms *MoneySense) RejectTransfer(out string, in string) error {
+	pairs := ms.loadTransferPairs()
+	if _, ok := pairs[transferKey(out, in)]; !ok {
+		if _, ok := pairs[transferKey(in, out)]; ok {
+			out, in = in, out
+		}
+	}
+	return ms.setTransfer(out, in, TransferRejected)
+}
+
+func (ms *MoneySense) setTransfer(out string, in string, status string) error {
+	_, err := ms.store.Exec(`DELETE FROM ms_transfers WHERE a = ? AND b = ?`, out, in)
+	if err != nil {
+		return err
+	}
+	_, err = ms.store.Exec(`INSERT INTO ms_transfers(a, b, status) VALUES(?, ?, ?)`, out, in, status)
+	if status != TransferMatched {
+		ms.warnInMemory()
+	}
+	return err
+}
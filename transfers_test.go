@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"./money"
+)
+
+func TestMatchCandidates(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	tx := func(id string, account string, d int, amount money.Amount, original money.Amount, currency string) Transaction {
+		return Transaction{ID: id, Account: account, Date: day(d), Amount: amount, Original: original, Currency: currency, converted: true}
+	}
+	unconverted := func(t Transaction) Transaction {
+		t.converted = false
+		return t
+	}
+	transactions := []Transaction{
+		tx("out", "checking", 10, 50000, 50000, "USD"),
+		tx("early", "savings", 6, -50000, -50000, "USD"),
+		tx("in", "savings", 11, -50000, -50000, "USD"),
+		tx("self", "checking", 11, -50000, -50000, "USD"),
+		tx("other", "savings", 12, -49000, -49000, "USD"),
+		tx("late", "savings", 14, -50000, -50000, "USD"),
+		tx("eur", "euro", 12, -49500, -45000, "EUR"),
+		tx("far", "euro", 12, -45000, -40000, "EUR"),
+		// Amounts without an exchange rate are only matched in their own
+		// currency.
+		unconverted(tx("gbp", "pounds", 12, -50000, -40000, "GBP")),
+	}
+	cases := []struct {
+		name     string
+		days     int
+		pairs    map[string]string
+		taken    map[string]bool
+		expected []string
+	}{
+		{"window", 3, nil, nil, []string{"in", "eur"}},
+		{"wider window", 4, nil, nil, []string{"early", "in", "late", "eur"}},
+		{"rejected", 3, map[string]string{transferKey("out", "in"): TransferRejected}, nil, []string{"eur"}},
+		{"taken", 3, nil, map[string]bool{"eur": true}, []string{"in"}},
+		{"out taken", 3, nil, map[string]bool{"out": true}, nil},
+	}
+	for _, c := range cases {
+		var ins []string
+		for _, m := range matchCandidates(transactions, c.days, c.pairs, c.taken) {
+			if m.Out.ID != "out" {
+				t.Errorf("%v: unexpected out %v", c.name, m.Out.ID)
+			}
+			ins = append(ins, m.In.ID)
+		}
+		if len(ins) != len(c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, ins)
+			continue
+		}
+		for i := range ins {
+			if ins[i] != c.expected[i] {
+				t.Errorf("%v: expected %v, got %v", c.name, c.expected, ins)
+				break
+			}
+		}
+	}
+}